@@ -7,25 +7,37 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"image-api/internal/api"
+	"image-api/internal/backend"
+	"image-api/internal/broker"
+	"image-api/internal/cropper"
 	"image-api/internal/health"
+	"image-api/internal/imageproc"
 	"image-api/internal/jobdb"
+	"image-api/internal/jobview"
+	"image-api/internal/jobwatch"
+	"image-api/internal/netfetch"
+	"image-api/internal/retention"
+	"image-api/internal/uploader"
 
-	"cloud.google.com/go/pubsub"
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/go-chi/chi/v5"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	middleware "github.com/oapi-codegen/chi-middleware"
 	openapi_types "github.com/oapi-codegen/runtime/types"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 func main() {
@@ -35,18 +47,61 @@ func main() {
 	if dbDSN == "" {
 		fatal("JOB_DB_DSN is required")
 	}
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	if projectID == "" {
-		fatal("GCP_PROJECT_ID is required")
+	watchInterval := time.Second
+	if raw := os.Getenv("JOB_WATCH_INTERVAL"); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v > 0 {
+			watchInterval = time.Duration(v * float64(time.Second))
+		}
+	}
+	hostPolicy := netfetch.HostPolicy{
+		Allow: netfetch.ParseHostPatterns(os.Getenv("SOURCE_HOST_ALLOWLIST")),
+		Deny:  netfetch.ParseHostPatterns(os.Getenv("SOURCE_HOST_DENYLIST")),
+	}
+	allowedCIDRs, err := netfetch.ParseCIDRs(os.Getenv("FETCH_ALLOWED_CIDRS"))
+	if err != nil {
+		fatal("invalid FETCH_ALLOWED_CIDRS", "err", err)
+	}
+	// POST /crop runs inline, so it gets tighter limits than the worker.
+	syncLimits := imageproc.Limits{
+		MaxBytes:  envInt64("SYNC_IMAGE_MAX_BYTES", 2*1024*1024),
+		MaxPixels: envInt("SYNC_IMAGE_MAX_PIXELS", 4_000_000),
 	}
-	topicName := os.Getenv("PUBSUB_TOPIC")
-	if topicName == "" {
-		fatal("PUBSUB_TOPIC is required")
+	syncTimeout := time.Duration(envInt("SYNC_TIMEOUT_SECONDS", 10)) * time.Second
+	// Uploaded sources get the worker's limits, since the worker processes them.
+	uploadLimits := imageproc.Limits{
+		MaxBytes:  envInt64("IMAGE_MAX_BYTES", 10*1024*1024),
+		MaxPixels: envInt("IMAGE_MAX_PIXELS", 25_000_000),
 	}
-	pubsubMode := os.Getenv("PUBSUB_MODE")
-	if pubsubMode == "" {
-		pubsubMode = "cloud"
+
+	// Uploads (POST /crop response=urls and POST /jobs/image-crop/upload) are optional on the API.
+	backendCfg := backend.ConfigFromEnv()
+	var objectUploader uploader.Uploader
+	if os.Getenv("UPLOAD_BACKEND") != "" {
+		up, closeUploader, err := backend.New(context.Background(), backendCfg)
+		if err != nil {
+			fatal("failed to configure upload backend", "err", err)
+		}
+		defer closeUploader()
+		objectUploader = up
+	}
+	// Private results are only readable through URLs signed here, reused while most of their
+	// lifetime remains.
+	var signResults jobview.SignFunc
+	if backendCfg.Private {
+		signer, ok := objectUploader.(uploader.URLSigner)
+		if !ok {
+			fatal("PRIVATE_RESULTS requires an UPLOAD_BACKEND that can sign URLs")
+		}
+		signResults = jobview.CachedSigner(signer, time.Duration(envInt("RESULT_URL_TTL_SECONDS", 900))*time.Second)
 	}
+	syncCropper := cropper.NewProcessor(
+		netfetch.NewClient(syncTimeout, netfetch.Guard{AllowedCIDRs: allowedCIDRs}),
+		objectUploader,
+		syncLimits,
+		envInt("IMAGE_JPEG_QUALITY", 90),
+		hostPolicy,
+		nil,
+	)
 
 	db, err := jobdb.Open(dbDSN)
 	if err != nil {
@@ -54,24 +109,15 @@ func main() {
 	}
 	defer db.Close()
 
-	pubsubClient, err := pubsub.NewClient(context.Background(), projectID)
+	publisher, err := broker.NewPublisher(context.Background(), broker.ConfigFromEnv())
 	if err != nil {
-		fatal("failed to create pubsub client", "err", err)
-	}
-	defer pubsubClient.Close()
-
-	topic := pubsubClient.Topic(topicName)
-	defer topic.Stop()
-
-	if pubsubMode == "emulator" {
-		if err := ensureTopicWithRetry(context.Background(), pubsubClient, topicName, 10, 500*time.Millisecond); err != nil {
-			fatal("failed to ensure pubsub topic", "err", err)
-		}
+		fatal("failed to configure message broker", "err", err)
 	}
+	defer publisher.Close()
 
 	router := chi.NewRouter()
 	health.Register(router, func(ctx context.Context) error {
-		return checkAPIReady(ctx, db, topic)
+		return checkAPIReady(ctx, db, publisher)
 	})
 
 	// Load and validate the OpenAPI spec, then attach request validation middleware.
@@ -87,9 +133,33 @@ func main() {
 		fatal("invalid openapi spec", "err", err)
 	}
 
+	// One poller serves every long-poll and SSE waiter in this process.
+	watcher := jobwatch.New(func(ctx context.Context, ids []string) (map[string]string, error) {
+		return jobdb.GetJobStatuses(ctx, db, ids)
+	}, watchInterval)
+	go watcher.Run(context.Background())
+
+	// Uploaded images arrive as image/* bodies or multipart parts; let the validator accept them as files.
+	for _, contentType := range []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/tiff", "image/bmp"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+
 	apiRouter := chi.NewRouter()
+	apiRouter.Use(limitRequestBody(uploadLimits.MaxBytes + maxFormFieldBytes))
 	apiRouter.Use(middleware.OapiRequestValidator(swagger))
-	api.HandlerFromMux(&server{db: db, topic: topic}, apiRouter)
+	api.HandlerFromMux(&server{
+		db:           db,
+		publisher:    publisher,
+		hosts:        hostPolicy,
+		watcher:      watcher,
+		cropper:      syncCropper,
+		syncTimeout:  syncTimeout,
+		syncLimits:   syncLimits,
+		uploader:     objectUploader,
+		uploadLimits: uploadLimits,
+		uploadURLTTL: time.Duration(envInt("UPLOAD_URL_TTL_SECONDS", 900)) * time.Second,
+		signResults:  signResults,
+	}, apiRouter)
 	router.Mount("/", apiRouter)
 
 	port := os.Getenv("PORT")
@@ -103,9 +173,26 @@ func main() {
 	}
 }
 
+const (
+	maxLongPollWait      = 60 * time.Second
+	sseKeepaliveInterval = 15 * time.Second
+	maxFormFieldBytes    = 1 << 20
+	// Lets a worker finishing a just-cancelled job stop uploading before its crops are removed.
+	jobDeletionGrace = time.Minute
+)
+
 type server struct {
-	db    *sql.DB
-	topic *pubsub.Topic
+	db           *sql.DB
+	publisher    broker.Publisher
+	hosts        netfetch.HostPolicy
+	watcher      *jobwatch.Notifier
+	cropper      *cropper.Processor
+	syncTimeout  time.Duration
+	syncLimits   imageproc.Limits
+	uploader     uploader.Uploader
+	uploadLimits imageproc.Limits
+	uploadURLTTL time.Duration
+	signResults  jobview.SignFunc
 }
 
 func (s *server) PostJobsImageCrop(w http.ResponseWriter, r *http.Request, params api.PostJobsImageCropParams) {
@@ -125,43 +212,90 @@ func (s *server) PostJobsImageCrop(w http.ResponseWriter, r *http.Request, param
 		writeError(w, http.StatusBadRequest, "at least one image is required")
 		return
 	}
-	for _, item := range req.Images {
-		if item.ImageUrl == "" {
-			writeError(w, http.StatusBadRequest, "imageUrl is required")
+	if req.CallbackUrl != nil && !isHTTPURL(*req.CallbackUrl) {
+		writeError(w, http.StatusBadRequest, "callbackUrl must be an absolute http or https url")
+		return
+	}
+	for i, item := range req.Images {
+		if item.SourceObject != nil {
+			writeError(w, http.StatusBadRequest, "sourceObject is set by the server")
 			return
 		}
-		if len(item.CropAreas) == 0 {
-			writeError(w, http.StatusBadRequest, "cropAreas is required")
+		switch {
+		case item.ImageUrl != nil && item.UploadId != nil:
+			writeError(w, http.StatusBadRequest, "set only one of imageUrl or uploadId")
 			return
-		}
-		for _, area := range item.CropAreas {
-			if area.Width <= 0 || area.Height <= 0 {
-				writeError(w, http.StatusBadRequest, "width and height must be greater than 0")
+		case item.UploadId != nil:
+			// Point the worker at the object the client PUT to its signed URL.
+			upload, ok, err := jobdb.GetUpload(s.db, item.UploadId.String())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to fetch upload")
+				return
+			}
+			if !ok {
+				writeError(w, http.StatusBadRequest, "unknown uploadId")
 				return
 			}
-			if area.X < 0 || area.Y < 0 {
-				writeError(w, http.StatusBadRequest, "x and y must be >= 0")
+			if expiresAt, err := time.Parse(time.RFC3339, upload.ExpiresAt); err != nil || !time.Now().Before(expiresAt) {
+				writeError(w, http.StatusBadRequest, "uploadId has expired")
+				return
+			}
+			if s.uploader != nil {
+				// Catch missing or oversized uploads now rather than as a failed job.
+				info, err := s.uploader.Stat(r.Context(), upload.ObjectName)
+				if errors.Is(err, uploader.ErrNotFound) {
+					writeError(w, http.StatusBadRequest, "uploadId has no uploaded image yet")
+					return
+				}
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "failed to check upload")
+					return
+				}
+				if info.Size > s.uploadLimits.MaxBytes {
+					writeError(w, http.StatusBadRequest, "uploaded image exceeds the size limit")
+					return
+				}
+			}
+			req.Images[i].SourceObject = &upload.ObjectName
+		case item.ImageUrl != nil && *item.ImageUrl != "":
+			if err := s.hosts.Check(*item.ImageUrl); err != nil {
+				writeError(w, http.StatusBadRequest, "imageUrl host is not allowed")
 				return
 			}
+		default:
+			writeError(w, http.StatusBadRequest, "imageUrl or uploadId is required")
+			return
+		}
+		if err := validateCropAreas(item.CropAreas, s.uploadLimits.MaxPixels); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 	}
 
+	s.enqueueJob(w, r, req, params.IdempotencyKey, hashBody(body))
+}
+
+func (s *server) enqueueJob(w http.ResponseWriter, r *http.Request, req api.ImageCropRequest, idempotencyKey *string, requestHash string) {
+	// Store the job with its outbox row (deduplicated by idempotency key) and publish it.
 	payload, err := json.Marshal(req)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to encode payload")
 		return
 	}
 
-	if params.IdempotencyKey != nil && *params.IdempotencyKey != "" {
-		idemKey := *params.IdempotencyKey
+	if idempotencyKey != nil && *idempotencyKey != "" {
+		idemKey := *idempotencyKey
 		// Reuse the existing job when the same key+payload is retried.
-		hash := hashBody(body)
-		job, outbox, reused, err := jobdb.InsertJobWithOutboxAndIdempotency(s.db, payload, idemKey, hash)
+		job, outbox, reused, err := jobdb.InsertJobWithOutboxAndIdempotency(s.db, payload, idemKey, requestHash)
 		if err != nil {
 			if errors.Is(err, jobdb.ErrIdempotencyKeyConflict) {
 				writeError(w, http.StatusConflict, "idempotency key reused with different payload")
 				return
 			}
+			if errors.Is(err, jobdb.ErrUploadUnavailable) {
+				writeError(w, http.StatusConflict, "uploadId has expired or was already used by another job")
+				return
+			}
 			writeError(w, http.StatusInternalServerError, "failed to create job")
 			return
 		}
@@ -176,11 +310,15 @@ func (s *server) PostJobsImageCrop(w http.ResponseWriter, r *http.Request, param
 			// Same idempotency key and payload: return the existing job instead of creating a new one.
 			status = http.StatusOK
 		}
-		writeJSON(w, buildJobResponse(job), status)
+		s.writeJob(w, r, job, status)
 		return
 	}
 
 	job, outbox, err := jobdb.InsertJobWithOutbox(s.db, payload)
+	if errors.Is(err, jobdb.ErrUploadUnavailable) {
+		writeError(w, http.StatusConflict, "uploadId has expired or was already used by another job")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create job")
 		return
@@ -190,7 +328,401 @@ func (s *server) PostJobsImageCrop(w http.ResponseWriter, r *http.Request, param
 		slog.Error("publish failed for job", "job_id", job.ID, "err", err)
 	}
 
-	writeJSON(w, buildJobResponse(job), http.StatusCreated)
+	s.writeJob(w, r, job, http.StatusCreated)
+}
+
+func (s *server) PostJobsImageCropUpload(w http.ResponseWriter, r *http.Request, params api.PostJobsImageCropUploadParams) {
+	// Accept the source image as multipart/form-data or a raw image/* body, store it
+	// under sources/, and enqueue a job the worker serves from storage instead of fetching.
+	if s.uploader == nil {
+		writeError(w, http.StatusNotImplemented, "uploads are not configured")
+		return
+	}
+
+	var upload sourceUpload
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "multipart/form-data":
+		upload, err = readMultipartUpload(r, s.uploadLimits.MaxBytes)
+	case strings.HasPrefix(mediaType, "image/"):
+		upload.image, err = readLimited(r.Body, s.uploadLimits.MaxBytes)
+		if params.CropAreas != nil {
+			upload.cropAreas = *params.CropAreas
+		}
+		upload.callbackURL = params.CallbackUrl
+	default:
+		writeError(w, http.StatusBadRequest, "content type must be multipart/form-data or image/*")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "image exceeds the upload size limit")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(upload.image) == 0 {
+		writeError(w, http.StatusBadRequest, "image is required")
+		return
+	}
+	var cropAreas []api.CropArea
+	if err := json.Unmarshal([]byte(upload.cropAreas), &cropAreas); err != nil {
+		writeError(w, http.StatusBadRequest, "cropAreas must be a JSON array of crop areas")
+		return
+	}
+	if err := validateCropAreas(cropAreas, s.uploadLimits.MaxPixels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if upload.callbackURL != nil && !isHTTPURL(*upload.callbackURL) {
+		writeError(w, http.StatusBadRequest, "callbackUrl must be an absolute http or https url")
+		return
+	}
+
+	// Check the header before storing anything so non-images and oversized ones never land in sources/.
+	info, err := imageproc.InspectImage(upload.image, s.uploadLimits.MaxPixels)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Name sources by content hash so repeated uploads of one image share an object.
+	sum := sha256.Sum256(upload.image)
+	objectName := fmt.Sprintf("sources/%s.%s", hex.EncodeToString(sum[:]), sourceExtension(info.Format))
+	// Sources stay private even when results are public; the worker reads them from storage.
+	if private, ok := s.uploader.(uploader.PrivateUploader); ok {
+		err = private.UploadPrivate(r.Context(), objectName, upload.image, "image/"+info.Format)
+	} else {
+		_, err = s.uploader.Upload(r.Context(), objectName, upload.image, "image/"+info.Format)
+	}
+	if err != nil {
+		slog.Error("source upload failed", "object", objectName, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store image")
+		return
+	}
+
+	var req api.ImageCropRequest
+	req.CallbackUrl = upload.callbackURL
+	req.Images = append(req.Images, struct {
+		CropAreas    []api.CropArea      `json:"cropAreas"`
+		ImageUrl     *string             `json:"imageUrl,omitempty"`
+		SourceObject *string             `json:"sourceObject,omitempty"`
+		UploadId     *openapi_types.UUID `json:"uploadId,omitempty"`
+	}{CropAreas: cropAreas, SourceObject: &objectName})
+
+	// The image bytes are already folded into objectName, so hashing the payload
+	// detects Idempotency-Key reuse with a different image or crops.
+	payload, err := json.Marshal(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode payload")
+		return
+	}
+	s.enqueueJob(w, r, req, params.IdempotencyKey, hashBody(payload))
+}
+
+func (s *server) PostUploads(w http.ResponseWriter, r *http.Request) {
+	// Hand out a time-limited signed PUT URL so large sources go straight to storage.
+	signer, ok := s.uploader.(uploader.URLSigner)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "upload backend cannot sign urls")
+		return
+	}
+
+	var req api.CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	contentType := string(req.ContentType)
+	format, ok := strings.CutPrefix(contentType, "image/")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "contentType must be an image type")
+		return
+	}
+
+	objectName := fmt.Sprintf("sources/uploads/%s.%s", uuid.NewString(), sourceExtension(format))
+	expiresAt := time.Now().Add(s.uploadURLTTL)
+	signed, err := signer.SignURL(r.Context(), objectName, uploader.SignOptions{
+		Method:      http.MethodPut,
+		ContentType: contentType,
+		MaxBytes:    s.uploadLimits.MaxBytes,
+		Expires:     s.uploadURLTTL,
+	})
+	if err != nil {
+		if errors.Is(err, uploader.ErrSigningNotConfigured) {
+			writeError(w, http.StatusNotImplemented, "upload backend cannot sign urls")
+			return
+		}
+		slog.Error("sign upload url failed", "object", objectName, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to sign upload url")
+		return
+	}
+
+	upload, err := jobdb.InsertUpload(s.db, objectName, contentType, expiresAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create upload")
+		return
+	}
+
+	writeJSON(w, api.UploadResponse{
+		UploadId:  uuid.MustParse(upload.ID),
+		UploadUrl: signed.URL,
+		Method:    http.MethodPut,
+		Headers:   signed.Headers,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}, http.StatusCreated)
+}
+
+type sourceUpload struct {
+	image       []byte
+	cropAreas   string
+	callbackURL *string
+}
+
+var errUploadTooLarge = errors.New("upload too large")
+
+func readMultipartUpload(r *http.Request, maxBytes int64) (sourceUpload, error) {
+	// Stream parts so only the image (bounded by maxBytes) and small fields are buffered.
+	var upload sourceUpload
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return upload, errors.New("invalid multipart body")
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return upload, nil
+		}
+		if err != nil {
+			return upload, errors.New("invalid multipart body")
+		}
+
+		switch part.FormName() {
+		case "image":
+			upload.image, err = readLimited(part, maxBytes)
+		case "cropAreas":
+			var raw []byte
+			raw, err = readLimited(part, maxFormFieldBytes)
+			upload.cropAreas = string(raw)
+		case "callbackUrl":
+			var raw []byte
+			raw, err = readLimited(part, maxFormFieldBytes)
+			callbackURL := string(raw)
+			upload.callbackURL = &callbackURL
+		}
+		_ = part.Close()
+		if err != nil {
+			return upload, err
+		}
+	}
+}
+
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errUploadTooLarge
+	}
+	return data, nil
+}
+
+func sourceExtension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+func limitRequestBody(maxBytes int64) func(http.Handler) http.Handler {
+	// Cap bodies before request validation buffers them in memory.
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *server) PostCrop(w http.ResponseWriter, r *http.Request) {
+	// Run the crop pipeline inline for small images, skipping the job queue.
+	var req api.SyncCropRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.ImageUrl == "" {
+		writeError(w, http.StatusBadRequest, "imageUrl is required")
+		return
+	}
+	if err := s.hosts.Check(req.ImageUrl); err != nil {
+		writeError(w, http.StatusBadRequest, "imageUrl host is not allowed")
+		return
+	}
+	if err := validateCropAreas(req.CropAreas, s.syncLimits.MaxPixels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mode := api.Image
+	if req.Response != nil {
+		mode = *req.Response
+	}
+	if mode == api.Image && len(req.CropAreas) != 1 {
+		writeError(w, http.StatusBadRequest, "response image requires exactly one crop area")
+		return
+	}
+	if mode == api.Urls && s.uploader == nil {
+		writeError(w, http.StatusNotImplemented, "uploads are not configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.syncTimeout)
+	defer cancel()
+
+	crops, err := s.cropper.Render(ctx, req.ImageUrl, req.CropAreas)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "crop timed out")
+			return
+		}
+		slog.Warn("sync crop failed", "image_url", req.ImageUrl, "err", err)
+		writeError(w, http.StatusUnprocessableEntity, syncCropError(err))
+		return
+	}
+
+	if mode == api.Image {
+		crop := crops[0]
+		w.Header().Set("Content-Type", crop.Format.ContentType())
+		w.Header().Set("Content-Length", strconv.Itoa(len(crop.Data)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(crop.Data)
+		return
+	}
+
+	// Synchronous crops are not jobs, so they live under their own prefix, grouped by day for
+	// the janitor to expire.
+	prefix := retention.SyncResultPrefix(time.Now()) + uuid.NewString()
+	urls := make([]string, 0, len(crops))
+	objects := make([]string, 0, len(crops))
+	for i, crop := range crops {
+		objectName := fmt.Sprintf("%s/0_%d.%s", prefix, i, crop.Format.Extension())
+		publicURL, err := s.cropper.Upload(ctx, objectName, crop)
+		if err != nil {
+			slog.Error("sync crop upload failed", "object", objectName, "err", err)
+			writeError(w, http.StatusInternalServerError, "failed to upload crop")
+			return
+		}
+		urls = append(urls, publicURL)
+		objects = append(objects, objectName)
+	}
+	if s.signResults != nil {
+		if urls, err = s.signResults(ctx, objects); err != nil {
+			slog.Error("failed to sign sync crop urls", "err", err)
+			writeError(w, http.StatusInternalServerError, "failed to sign result urls")
+			return
+		}
+	}
+	writeJSON(w, api.SyncCropResponse{CroppedImageUrls: urls}, http.StatusOK)
+}
+
+// syncCropErrors are the failures POST /crop reports by name; their messages are stable and
+// reveal nothing about the fetch or decode internals.
+var syncCropErrors = []error{
+	netfetch.ErrInvalidURL,
+	netfetch.ErrTooLarge,
+	netfetch.ErrTooManyRedirects,
+	netfetch.ErrHostNotAllowed,
+	imageproc.ErrImageTooLarge,
+	imageproc.ErrImageTooManyPixels,
+	imageproc.ErrUnsupportedFormat,
+	imageproc.ErrInvalidImageHeader,
+	imageproc.ErrCropOutOfBounds,
+	imageproc.ErrCropInvalid,
+	imageproc.ErrResizeInvalid,
+	imageproc.ErrUnknownFit,
+	imageproc.ErrUnknownFilter,
+	imageproc.ErrUnknownFormat,
+	imageproc.ErrUnknownCompression,
+	imageproc.ErrUnknownMetadataMode,
+}
+
+func syncCropError(err error) string {
+	// Map a pipeline error to a public message; the full error is only logged.
+	for _, known := range syncCropErrors {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	if errors.Is(err, netfetch.ErrDownloadFailed) {
+		return "failed to fetch image"
+	}
+	return "failed to process image"
+}
+
+func validateCropAreas(areas []api.CropArea, maxPixels int) error {
+	// maxPixels is the cap of whoever processes the crops: the worker, or the API for POST /crop.
+	if len(areas) == 0 {
+		return errors.New("cropAreas is required")
+	}
+	for _, area := range areas {
+		if area.Width <= 0 || area.Height <= 0 {
+			return errors.New("width and height must be greater than 0")
+		}
+		if area.X < 0 || area.Y < 0 {
+			return errors.New("x and y must be >= 0")
+		}
+		if area.Resize != nil {
+			if err := validateResize(*area.Resize, area.Width, area.Height, maxPixels); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateResize(resize api.Resize, cropWidth, cropHeight, maxPixels int) error {
+	// Mirror the worker's resize checks so bad dimensions are rejected at submission time.
+	width, height := 0, 0
+	if resize.Width != nil {
+		width = *resize.Width
+	}
+	if resize.Height != nil {
+		height = *resize.Height
+	}
+	if width < 0 || height < 0 {
+		return errors.New("resize width and height must be >= 0")
+	}
+	if width == 0 && height == 0 {
+		return errors.New("resize requires width or height")
+	}
+	if width > imageproc.MaxResizeDimension || height > imageproc.MaxResizeDimension {
+		return fmt.Errorf("resize width and height must be <= %d", imageproc.MaxResizeDimension)
+	}
+	target := imageproc.Resize{Width: width, Height: height}
+	if resize.Fit != nil {
+		target.Fit = imageproc.Fit(*resize.Fit)
+	}
+	if err := imageproc.ValidateResize(target, cropWidth, cropHeight, maxPixels); errors.Is(err, imageproc.ErrImageTooManyPixels) {
+		return fmt.Errorf("resized crop would exceed %d pixels", maxPixels)
+	}
+	return nil
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 func loadOpenAPISpec(path string) (*openapi3.T, error) {
@@ -198,8 +730,69 @@ func loadOpenAPISpec(path string) (*openapi3.T, error) {
 	return loader.LoadFromFile(path)
 }
 
-func (s *server) GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+func (s *server) GetJobs(w http.ResponseWriter, r *http.Request, params api.GetJobsParams) {
+	// List jobs newest first with optional filters and cursor pagination.
+	filter := jobdb.ListJobsFilter{Limit: 20}
+	if params.Status != nil {
+		filter.Status = string(*params.Status)
+	}
+	if params.CreatedAfter != nil {
+		filter.CreatedAfter = params.CreatedAfter.UTC().Format(time.RFC3339)
+	}
+	if params.CreatedBefore != nil {
+		filter.CreatedBefore = params.CreatedBefore.UTC().Format(time.RFC3339)
+	}
+	if params.IdempotencyKey != nil {
+		filter.IdempotencyKey = *params.IdempotencyKey
+	}
+	if params.Limit != nil {
+		filter.Limit = *params.Limit
+	}
+	if params.Cursor != nil && *params.Cursor != "" {
+		cursor, err := jobdb.DecodeCursor(*params.Cursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		filter.After = &cursor
+	}
+
+	jobs, next, err := jobdb.ListJobs(r.Context(), s.db, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list jobs")
+		return
+	}
+
+	resp := api.JobListResponse{Jobs: make([]api.JobResponse, 0, len(jobs))}
+	for _, job := range jobs {
+		jobResp, err := s.jobResponse(r.Context(), job)
+		if err != nil {
+			slog.Error("failed to sign result urls", "job_id", job.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "failed to sign result urls")
+			return
+		}
+		resp.Jobs = append(resp.Jobs, jobResp)
+	}
+	if next != nil {
+		token := jobdb.EncodeCursor(*next)
+		resp.NextCursor = &token
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+func (s *server) GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID, params api.GetJobsIdParams) {
 	// Return job status and any resulting cropped image URL or error.
+	// With ?wait=, hold the request until the job finishes or the wait elapses.
+	var wait time.Duration
+	if params.Wait != nil {
+		d, err := time.ParseDuration(*params.Wait)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "invalid wait duration")
+			return
+		}
+		wait = min(d, maxLongPollWait)
+	}
+
 	job, ok, err := jobdb.GetJob(s.db, id.String())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch job")
@@ -210,85 +803,205 @@ func (s *server) GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_ty
 		return
 	}
 
-	writeJSON(w, buildJobResponse(job), http.StatusOK)
-}
+	if wait > 0 && !jobwatch.IsFinished(job.Status) {
+		done, release := s.watcher.Subscribe(job.ID)
+		defer release()
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
 
-func writeJSON(w http.ResponseWriter, v any, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(v)
-}
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
 
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, api.ErrorResponse{Message: message}, status)
+		job, ok, err = jobdb.GetJob(s.db, id.String())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch job")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+	}
+
+	s.writeJob(w, r, job, http.StatusOK)
 }
 
-func extractCroppedImageURLs(result json.RawMessage) []string {
-	// Pull croppedImageUrls from the stored job result JSON.
-	if len(result) == 0 {
-		return nil
+func (s *server) GetJobsIdEvents(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	// Stream the job as Server-Sent Events: the current state now, then the final state
+	// once it leaves pending/in_progress, with keepalive comments in between.
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
 	}
 
-	var payload map[string]any
-	if err := json.Unmarshal(result, &payload); err != nil {
-		return nil
+	job, ok, err := jobdb.GetJob(s.db, id.String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch job")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
 	}
 
-	if rawList, ok := payload["croppedImageUrls"]; ok {
-		items, ok := rawList.([]any)
-		if !ok {
-			return nil
-		}
-		var urls []string
-		for _, item := range items {
-			if url, ok := item.(string); ok && url != "" {
-				urls = append(urls, url)
-			}
-		}
-		if len(urls) > 0 {
-			return urls
-		}
+	// Subscribe before the first event so a finish in between is not missed.
+	done, release := s.watcher.Subscribe(job.ID)
+	defer release()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := s.writeJobEvent(r.Context(), w, job); err != nil {
+		return
+	}
+	flusher.Flush()
+	if jobwatch.IsFinished(job.Status) {
+		return
 	}
 
-	if raw, ok := payload["croppedImageUrl"]; ok {
-		if url, ok := raw.(string); ok && url != "" {
-			return []string{url}
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-done:
+			job, ok, err := jobdb.GetJob(s.db, id.String())
+			if err != nil || !ok {
+				return
+			}
+			if err := s.writeJobEvent(r.Context(), w, job); err != nil {
+				return
+			}
+			flusher.Flush()
+			return
 		}
 	}
+}
 
-	return nil
+func (s *server) writeJobEvent(ctx context.Context, w io.Writer, job jobdb.Job) error {
+	resp, err := s.jobResponse(ctx, job)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+	return err
 }
 
-func extractError(errText sql.NullString) *string {
-	// Return a non-empty error string if present.
-	if !errText.Valid || errText.String == "" {
-		return nil
+func (s *server) PostJobsIdCancel(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	// Cancel a pending or in-progress job; workers stop at the next crop boundary.
+	cancelled, err := jobdb.CancelJob(s.db, id.String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to cancel job")
+		return
+	}
+	if cancelled {
+		s.watcher.Notify(id.String())
+	}
+
+	job, ok, err := jobdb.GetJob(s.db, id.String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch job")
+		return
 	}
-	return &errText.String
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if job.Status != "cancelled" {
+		writeError(w, http.StatusConflict, "job already finished")
+		return
+	}
+
+	s.writeJob(w, r, job, http.StatusOK)
 }
 
-func mustParseUUID(id string) uuid.UUID {
-	parsed, err := uuid.Parse(id)
+func (s *server) PostJobsIdRetry(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	// Re-queue a failed job under the same ID with a fresh outbox message.
+	outbox, retried, err := jobdb.RetryJob(s.db, id.String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to retry job")
+		return
+	}
+
+	job, ok, err := jobdb.GetJob(s.db, id.String())
 	if err != nil {
-		return uuid.Nil
+		writeError(w, http.StatusInternalServerError, "failed to fetch job")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if !retried {
+		writeError(w, http.StatusConflict, "only failed jobs can be retried")
+		return
+	}
+
+	if err := s.publishJob(r.Context(), outbox.ID, outbox.Payload); err != nil {
+		slog.Error("publish failed for job", "job_id", job.ID, "err", err)
 	}
-	return parsed
+
+	s.writeJob(w, r, job, http.StatusOK)
 }
 
-func buildJobResponse(job jobdb.Job) api.JobResponse {
-	urls := extractCroppedImageURLs(job.Result)
-	var urlsPtr *[]string
-	if len(urls) > 0 {
-		urlsPtr = &urls
+func (s *server) DeleteJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	// Erase the job now; the publisher removes its crops from storage afterwards.
+	deleted, err := jobdb.DeleteJob(s.db, id.String(), time.Now().Add(jobDeletionGrace))
+	if errors.Is(err, jobdb.ErrJobInProgress) {
+		writeError(w, http.StatusConflict, "job is in progress; cancel it first")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete job")
+		return
 	}
-	return api.JobResponse{
-		Id:               mustParseUUID(job.ID),
-		Status:           job.Status,
-		CroppedImageUrls: urlsPtr,
-		Error:            extractError(job.Error),
-		CreatedAt:        job.CreatedAt,
-		UpdatedAt:        job.UpdatedAt,
+	if !deleted {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	s.watcher.Notify(id.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, api.ErrorResponse{Message: message}, status)
+}
+
+func (s *server) writeJob(w http.ResponseWriter, r *http.Request, job jobdb.Job, status int) {
+	resp, err := s.jobResponse(r.Context(), job)
+	if err != nil {
+		slog.Error("failed to sign result urls", "job_id", job.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to sign result urls")
+		return
 	}
+	writeJSON(w, resp, status)
+}
+
+func (s *server) jobResponse(ctx context.Context, job jobdb.Job) (api.JobResponse, error) {
+	// In private mode, replace stored URLs with signed ones for the result objects.
+	return jobview.Response(ctx, job, s.signResults)
 }
 
 func hashBody(body []byte) string {
@@ -296,14 +1009,13 @@ func hashBody(body []byte) string {
 	return hex.EncodeToString(sum[:])
 }
 
-func checkAPIReady(ctx context.Context, db *sql.DB, topic *pubsub.Topic) error {
+func checkAPIReady(ctx context.Context, db *sql.DB, publisher broker.Publisher) error {
 	checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	if err := db.PingContext(checkCtx); err != nil {
 		return err
 	}
-	_, err := topic.Exists(checkCtx)
-	return err
+	return publisher.Ready(checkCtx)
 }
 
 func fatal(msg string, attrs ...any) {
@@ -312,44 +1024,31 @@ func fatal(msg string, attrs ...any) {
 }
 
 func (s *server) publishJob(ctx context.Context, outboxID string, payload json.RawMessage) error {
-	// Publish the outbox payload to Pub/Sub and mark it published on success.
+	// Publish the outbox payload to the broker and mark it published on success.
 	publishCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	result := s.topic.Publish(publishCtx, &pubsub.Message{Data: payload})
-	if _, err := result.Get(publishCtx); err != nil {
+	if err := s.publisher.Publish(publishCtx, payload); err != nil {
 		_ = jobdb.RecordOutboxError(s.db, outboxID, err.Error())
 		return err
 	}
 	return jobdb.MarkOutboxPublished(s.db, outboxID)
 }
 
-func ensureTopic(ctx context.Context, client *pubsub.Client, topicName string) error {
-	// Used only for Pub/Sub emulator startup in local/dev.
-	topic := client.Topic(topicName)
-	exists, err := topic.Exists(ctx)
-	if err != nil {
-		return err
-	}
-	if exists {
-		return nil
-	}
-	_, err = client.CreateTopic(ctx, topicName)
-	if status.Code(err) == codes.AlreadyExists {
-		return nil
+func envInt64(key string, fallback int64) int64 {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return v
+		}
 	}
-	return err
+	return fallback
 }
 
-func ensureTopicWithRetry(ctx context.Context, client *pubsub.Client, topicName string, attempts int, delay time.Duration) error {
-	var lastErr error
-	for i := 0; i < attempts; i++ {
-		if err := ensureTopic(ctx, client, topicName); err == nil {
-			return nil
-		} else {
-			lastErr = err
+func envInt(key string, fallback int) int {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil {
+			return v
 		}
-		time.Sleep(delay)
 	}
-	return lastErr
+	return fallback
 }
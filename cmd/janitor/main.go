@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"image-api/internal/backend"
+	"image-api/internal/jobdb"
+	"image-api/internal/retention"
+	"image-api/internal/uploader"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const deletionTimeout = 2 * time.Minute
+
+func main() {
+	// Janitor: applies the retention policy to job tables and removes expired jobs' crops.
+	// Runs once and exits (Cloud Run job, cron) unless JANITOR_INTERVAL_SECONDS is set.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	dbDSN := os.Getenv("JOB_DB_DSN")
+	if dbDSN == "" {
+		fatal("JOB_DB_DSN is required")
+	}
+
+	policy := retention.Policy{
+		JobAge:            time.Duration(envInt("JOB_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		OutboxAge:         time.Duration(envInt("OUTBOX_RETENTION_HOURS", 7*24)) * time.Hour,
+		IdempotencyKeyAge: time.Duration(envInt("IDEMPOTENCY_KEY_TTL_HOURS", 24)) * time.Hour,
+		UploadAge:         time.Duration(envInt("UPLOAD_RETENTION_HOURS", 24)) * time.Hour,
+		SyncResultAge:     time.Duration(envInt("SYNC_RESULT_RETENTION_DAYS", 7)) * 24 * time.Hour,
+		JobLease:          time.Duration(envInt("JOB_LEASE_SECONDS", 900)) * time.Second,
+		BatchSize:         envInt("JANITOR_BATCH_SIZE", 500),
+	}
+	if policy.BatchSize <= 0 {
+		fatal("JANITOR_BATCH_SIZE must be positive")
+	}
+	interval := time.Duration(envInt("JANITOR_INTERVAL_SECONDS", 0)) * time.Second
+	deletionMaxAttempts := envInt("DELETION_MAX_ATTEMPTS", 10)
+
+	db, err := jobdb.Open(dbDSN)
+	if err != nil {
+		fatal("failed to open job db", "err", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	// Expired jobs queue their crops in deletion_outbox; with a backend configured the janitor
+	// removes them itself, otherwise the publisher's deletion loop does.
+	var store uploader.Uploader
+	if os.Getenv("UPLOAD_BACKEND") != "" {
+		up, closeStore, err := backend.New(ctx, backend.ConfigFromEnv())
+		if err != nil {
+			fatal("failed to configure upload backend", "err", err)
+		}
+		defer closeStore()
+		store = up
+	}
+
+	for {
+		if err := runOnce(ctx, db, store, policy, deletionMaxAttempts); err != nil {
+			slog.Error("janitor run failed", "err", err)
+			if interval == 0 {
+				os.Exit(1)
+			}
+		}
+		if interval == 0 {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func runOnce(ctx context.Context, db *sql.DB, store uploader.Uploader, policy retention.Policy, deletionMaxAttempts int) error {
+	stats, err := retention.Apply(ctx, db, policy, time.Now())
+	slog.Info("retention applied",
+		"reclaimed_jobs", stats.ReclaimedJobs,
+		"jobs", stats.Jobs,
+		"outbox", stats.OutboxRows,
+		"webhook_outbox", stats.WebhookRows,
+		"deletion_outbox", stats.DeletionRows,
+		"idempotency_keys", stats.IdempotencyKeys,
+		"uploads", stats.Uploads,
+	)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return nil
+	}
+
+	// Drain due deletions in batches; failed ones are rescheduled and picked up by a later run.
+	total := 0
+	for {
+		claimed, err := retention.ProcessDeletions(ctx, db, store, policy.BatchSize, deletionMaxAttempts, deletionTimeout)
+		if err != nil {
+			return err
+		}
+		total += claimed
+		if claimed < policy.BatchSize {
+			break
+		}
+	}
+	slog.Info("storage deletions processed", "claimed", total)
+
+	if policy.SyncResultAge > 0 {
+		deleted, err := retention.ExpireSyncResults(ctx, store, time.Now().Add(-policy.SyncResultAge))
+		slog.Info("sync results expired", "deleted", deleted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envInt(key string, fallback int) int {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			return v
+		}
+	}
+	return fallback
+}
+
+func fatal(msg string, attrs ...any) {
+	slog.Error(msg, attrs...)
+	os.Exit(1)
+}
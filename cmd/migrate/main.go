@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/mysql"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -23,7 +24,14 @@ func main() {
 		migrationsPath = "migrations"
 	}
 
-	db, err := sql.Open("mysql", dbDSN)
+	// Some migrations pair a schema change with the UPDATE that backfills it.
+	dsnConfig, err := mysqldriver.ParseDSN(dbDSN)
+	if err != nil {
+		fatal("invalid JOB_DB_DSN", "err", err)
+	}
+	dsnConfig.MultiStatements = true
+
+	db, err := sql.Open("mysql", dsnConfig.FormatDSN())
 	if err != nil {
 		fatal("failed to open job db", "err", err)
 	}
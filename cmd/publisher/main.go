@@ -3,48 +3,48 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
+	"image-api/internal/backend"
+	"image-api/internal/backoff"
+	"image-api/internal/broker"
 	"image-api/internal/health"
 	"image-api/internal/jobdb"
+	"image-api/internal/jobview"
+	"image-api/internal/netfetch"
+	"image-api/internal/retention"
+	"image-api/internal/uploader"
+	"image-api/internal/webhook"
 
-	"cloud.google.com/go/pubsub"
 	_ "github.com/go-sql-driver/mysql"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+)
+
+const (
+	webhookTimeout  = 10 * time.Second
+	deletionTimeout = 2 * time.Minute
 )
 
 func main() {
-	// Publisher service: polls unpublished outbox rows and publishes jobs to Pub/Sub.
+	// Publisher service: polls unpublished outbox rows and publishes jobs to the broker.
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
 
 	dbDSN := os.Getenv("JOB_DB_DSN")
 	if dbDSN == "" {
 		fatal("JOB_DB_DSN is required")
 	}
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	if projectID == "" {
-		fatal("GCP_PROJECT_ID is required")
-	}
-	topicName := os.Getenv("PUBSUB_TOPIC")
-	if topicName == "" {
-		fatal("PUBSUB_TOPIC is required")
-	}
-	pubsubMode := os.Getenv("PUBSUB_MODE")
-	if pubsubMode == "" {
-		pubsubMode = "cloud"
+	brokerCfg := broker.ConfigFromEnv()
+	brokerCfg.PushSubscription = os.Getenv("PUBSUB_SUBSCRIPTION")
+	if brokerCfg.PushSubscription == "" {
+		brokerCfg.PushSubscription = "image-jobs-push"
 	}
-	subscriptionName := os.Getenv("PUBSUB_SUBSCRIPTION")
-	if subscriptionName == "" {
-		subscriptionName = "image-jobs-push"
-	}
-	pushEndpoint := os.Getenv("PUBSUB_PUSH_ENDPOINT")
-	if pushEndpoint == "" {
-		pushEndpoint = "http://worker:8080/pubsub/jobs"
+	brokerCfg.PushEndpoint = os.Getenv("PUBSUB_PUSH_ENDPOINT")
+	if brokerCfg.PushEndpoint == "" {
+		brokerCfg.PushEndpoint = "http://worker:8080/pubsub/jobs"
 	}
 
 	pollInterval := 2 * time.Second
@@ -60,32 +60,86 @@ func main() {
 		}
 	}
 
+	// Receivers can only trust callbacks they can verify, so delivering unsigned ones is refused.
+	webhooksEnabled := true
+	if raw := os.Getenv("WEBHOOKS_ENABLED"); raw != "" {
+		if v, err := strconv.ParseBool(raw); err == nil {
+			webhooksEnabled = v
+		}
+	}
+	webhookSecret := []byte(os.Getenv("WEBHOOK_SECRET"))
+	if webhooksEnabled && len(webhookSecret) == 0 {
+		fatal("WEBHOOK_SECRET is required unless WEBHOOKS_ENABLED=false")
+	}
+	webhookMaxAttempts := 10
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			webhookMaxAttempts = v
+		}
+	}
+	webhookCIDRs, err := netfetch.ParseCIDRs(os.Getenv("WEBHOOK_ALLOWED_CIDRS"))
+	if err != nil {
+		fatal("invalid WEBHOOK_ALLOWED_CIDRS", "err", err)
+	}
+	webhookClient := netfetch.NewClient(webhookTimeout, netfetch.Guard{AllowedCIDRs: webhookCIDRs})
+	deletionMaxAttempts := 10
+	if raw := os.Getenv("DELETION_MAX_ATTEMPTS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			deletionMaxAttempts = v
+		}
+	}
+
 	db, err := jobdb.Open(dbDSN)
 	if err != nil {
 		fatal("failed to open job db", "err", err)
 	}
 	defer db.Close()
 
-	pubsubClient, err := pubsub.NewClient(context.Background(), projectID)
+	ctx := context.Background()
+	publisher, err := broker.NewPublisher(ctx, brokerCfg)
 	if err != nil {
-		fatal("failed to create pubsub client", "err", err)
+		fatal("failed to configure message broker", "err", err)
 	}
-	defer pubsubClient.Close()
-
-	topic := pubsubClient.Topic(topicName)
-	defer topic.Stop()
+	defer publisher.Close()
 
-	if pubsubMode == "emulator" {
-		if err := ensureTopicWithRetry(context.Background(), pubsubClient, topicName, 10, 500*time.Millisecond); err != nil {
-			fatal("failed to ensure pubsub topic", "err", err)
+	backendCfg := backend.ConfigFromEnv()
+	var store uploader.Uploader
+	if os.Getenv("UPLOAD_BACKEND") != "" {
+		up, closeStore, err := backend.New(ctx, backendCfg)
+		if err != nil {
+			fatal("failed to configure upload backend", "err", err)
 		}
-		if err := ensureSubscription(context.Background(), pubsubClient, topicName, subscriptionName, pushEndpoint); err != nil {
-			fatal("failed to ensure pubsub subscription", "err", err)
+		defer closeStore()
+		store = up
+	}
+
+	go runPublisherLoop(ctx, db, publisher, pollInterval, batchSize)
+	if webhooksEnabled {
+		// Private results reach receivers only through URLs signed for each delivery attempt.
+		var sign jobview.SignFunc
+		if backendCfg.Private {
+			signer, ok := store.(uploader.URLSigner)
+			if !ok {
+				fatal("PRIVATE_RESULTS requires an UPLOAD_BACKEND that can sign URLs")
+			}
+			resultURLTTL := 900 * time.Second
+			if raw := os.Getenv("RESULT_URL_TTL_SECONDS"); raw != "" {
+				if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+					resultURLTTL = time.Duration(v) * time.Second
+				}
+			}
+			sign = jobview.Signer(signer, resultURLTTL)
 		}
+		go runWebhookLoop(ctx, db, webhookClient, webhookSecret, sign, pollInterval, batchSize, webhookMaxAttempts)
 	}
 
-	ctx := context.Background()
-	go runPublisherLoop(ctx, db, topic, pollInterval, batchSize)
+	// Crops of deleted jobs are removed through the storage backend; without one, queued
+	// deletions wait until UPLOAD_BACKEND is configured here.
+	if store != nil {
+		go runDeletionLoop(ctx, db, store, pollInterval, batchSize, deletionMaxAttempts)
+	} else {
+		slog.Warn("UPLOAD_BACKEND is not set; crops of deleted jobs are not removed from storage")
+	}
 
 	mux := http.NewServeMux()
 	health.Register(mux, func(ctx context.Context) error {
@@ -102,7 +156,7 @@ func main() {
 	}
 }
 
-func runPublisherLoop(ctx context.Context, db *sql.DB, topic *pubsub.Topic, pollInterval time.Duration, batchSize int) {
+func runPublisherLoop(ctx context.Context, db *sql.DB, publisher broker.Publisher, pollInterval time.Duration, batchSize int) {
 	for {
 		messages, err := jobdb.ClaimOutboxBatch(ctx, db, batchSize)
 		if err != nil {
@@ -116,8 +170,7 @@ func runPublisherLoop(ctx context.Context, db *sql.DB, topic *pubsub.Topic, poll
 		}
 
 		for _, msg := range messages {
-			result := topic.Publish(ctx, &pubsub.Message{Data: msg.Payload})
-			if _, err := result.Get(ctx); err != nil {
+			if err := publisher.Publish(ctx, msg.Payload); err != nil {
 				_ = jobdb.RecordOutboxError(db, msg.ID, err.Error())
 				continue
 			}
@@ -128,58 +181,64 @@ func runPublisherLoop(ctx context.Context, db *sql.DB, topic *pubsub.Topic, poll
 	}
 }
 
-func ensureTopic(ctx context.Context, client *pubsub.Client, topicName string) error {
-	// Used only for Pub/Sub emulator startup in local/dev.
-	topic := client.Topic(topicName)
-	exists, err := topic.Exists(ctx)
-	if err != nil {
-		return err
-	}
-	if exists {
-		return nil
-	}
-	_, err = client.CreateTopic(ctx, topicName)
-	if status.Code(err) == codes.AlreadyExists {
-		return nil
-	}
-	return err
-}
+func runWebhookLoop(ctx context.Context, db *sql.DB, client *http.Client, secret []byte, sign jobview.SignFunc, pollInterval time.Duration, batchSize int, maxAttempts int) {
+	// Deliver queued job webhooks, rescheduling failures with exponential backoff.
+	for {
+		messages, err := jobdb.ClaimWebhookBatch(ctx, db, batchSize, maxAttempts, webhookTimeout+time.Minute)
+		if err != nil {
+			slog.Error("webhook claim failed", "err", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		if len(messages) == 0 {
+			time.Sleep(pollInterval)
+			continue
+		}
 
-func ensureTopicWithRetry(ctx context.Context, client *pubsub.Client, topicName string, attempts int, delay time.Duration) error {
-	var lastErr error
-	for i := 0; i < attempts; i++ {
-		if err := ensureTopic(ctx, client, topicName); err == nil {
-			return nil
-		} else {
-			lastErr = err
+		for _, msg := range messages {
+			body, err := webhookBody(ctx, msg.Payload, sign)
+			if err == nil {
+				err = webhook.Deliver(ctx, client, msg.URL, msg.ID, body, secret)
+			}
+			if err != nil {
+				slog.Warn("webhook delivery failed", "webhook_id", msg.ID, "job_id", msg.JobID, "attempt", msg.Attempts, "err", err)
+				next := time.Now().Add(backoff.Delay(msg.Attempts))
+				if err := jobdb.RecordWebhookError(db, msg.ID, err.Error(), next); err != nil {
+					slog.Error("record webhook error failed", "webhook_id", msg.ID, "err", err)
+				}
+				continue
+			}
+			if err := jobdb.MarkWebhookDelivered(db, msg.ID); err != nil {
+				slog.Error("mark delivered failed for webhook", "webhook_id", msg.ID, "err", err)
+			}
 		}
-		time.Sleep(delay)
 	}
-	return lastErr
 }
 
-func ensureSubscription(ctx context.Context, client *pubsub.Client, topicName, subName, pushEndpoint string) error {
-	// Used only for Pub/Sub emulator startup in local/dev.
-	sub := client.Subscription(subName)
-	exists, err := sub.Exists(ctx)
-	if err != nil {
-		return err
+func webhookBody(ctx context.Context, payload json.RawMessage, sign jobview.SignFunc) ([]byte, error) {
+	// Receivers get the public job shape GET /jobs/{id} returns, never the internal result.
+	var event jobdb.WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
 	}
-	if exists {
-		return nil
+	resp, err := jobview.Response(ctx, event.Job(), sign)
+	if err != nil {
+		return nil, err
 	}
+	return json.Marshal(resp)
+}
 
-	topic := client.Topic(topicName)
-	_, err = client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
-		Topic: topic,
-		PushConfig: pubsub.PushConfig{
-			Endpoint: pushEndpoint,
-		},
-	})
-	if status.Code(err) == codes.AlreadyExists {
-		return nil
+func runDeletionLoop(ctx context.Context, db *sql.DB, store uploader.Uploader, pollInterval time.Duration, batchSize int, maxAttempts int) {
+	// Remove deleted jobs' objects; failures are retried with backoff by later batches.
+	for {
+		claimed, err := retention.ProcessDeletions(ctx, db, store, batchSize, maxAttempts, deletionTimeout)
+		if err != nil {
+			slog.Error("deletion claim failed", "err", err)
+		}
+		if err != nil || claimed == 0 {
+			time.Sleep(pollInterval)
+		}
 	}
-	return err
 }
 
 func fatal(msg string, attrs ...any) {
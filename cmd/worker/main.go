@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -9,20 +10,23 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	"image-api/internal/api"
-	"image-api/internal/gcs"
+	"image-api/internal/backend"
+	"image-api/internal/broker"
+	"image-api/internal/cropper"
 	"image-api/internal/health"
 	"image-api/internal/imageproc"
 	"image-api/internal/jobdb"
 	"image-api/internal/localstore"
 	"image-api/internal/netfetch"
-	"image-api/internal/uploader"
+	"image-api/internal/oidc"
 
-	"cloud.google.com/go/storage"
 	_ "github.com/go-sql-driver/mysql"
+	"google.golang.org/api/idtoken"
 )
 
 func main() {
@@ -39,54 +43,125 @@ func main() {
 	}
 	defer db.Close()
 
-	backend := os.Getenv("UPLOAD_BACKEND")
-	if backend == "" {
-		backend = "gcs"
-	}
-
-	makePublic := envBool("GCS_PUBLIC", true)
-	allowACLFailure := envBool("GCS_PUBLIC_SKIP_ACL_ERRORS", false)
+	storageConfig := backend.ConfigFromEnv()
 	maxBytes := envInt64("IMAGE_MAX_BYTES", 10*1024*1024)
 	maxPixels := envInt("IMAGE_MAX_PIXELS", 25_000_000)
 	jpegQuality := envInt("IMAGE_JPEG_QUALITY", 90)
+	allowedCIDRs, err := netfetch.ParseCIDRs(os.Getenv("FETCH_ALLOWED_CIDRS"))
+	if err != nil {
+		fatal("invalid FETCH_ALLOWED_CIDRS", "err", err)
+	}
+	hostPolicy := netfetch.HostPolicy{
+		Allow: netfetch.ParseHostPatterns(os.Getenv("SOURCE_HOST_ALLOWLIST")),
+		Deny:  netfetch.ParseHostPatterns(os.Getenv("SOURCE_HOST_DENYLIST")),
+	}
 
-	var uploader uploader.Uploader
-	var localDir string
-	if backend == "local" {
-		localDir = os.Getenv("LOCAL_STORAGE_DIR")
-		if localDir == "" {
-			localDir = "/tmp/image-api"
-		}
-		baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL")
-		if baseURL == "" {
-			baseURL = "http://localhost:8001/files"
-		}
-		uploader = localstore.NewUploader(localDir, baseURL)
-	} else {
-		bucket := os.Getenv("GCS_BUCKET")
-		if bucket == "" {
-			fatal("GCS_BUCKET is required")
-		}
-		storageClient, err := storage.NewClient(context.Background())
-		if err != nil {
-			fatal("failed to create storage client", "err", err)
-		}
-		defer storageClient.Close()
-		uploader = gcs.NewUploader(storageClient, bucket, makePublic, allowACLFailure)
+	uploader, closeUploader, err := backend.New(context.Background(), storageConfig)
+	if err != nil {
+		fatal("failed to configure upload backend", "err", err)
 	}
+	defer closeUploader()
 
-	processor := newJobProcessor(
-		&http.Client{Timeout: 20 * time.Second},
+	processor := cropper.NewProcessor(
+		netfetch.NewClient(20*time.Second, netfetch.Guard{AllowedCIDRs: allowedCIDRs}),
 		uploader,
 		imageproc.Limits{MaxBytes: maxBytes, MaxPixels: maxPixels},
 		jpegQuality,
+		hostPolicy,
+		func(ctx context.Context, jobID string) (bool, error) {
+			return jobdb.IsJobCancelled(ctx, db, jobID)
+		},
 	)
+	processor.ContentAddressed = envBool("CONTENT_ADDRESSED_OUTPUTS", false)
+	processor.RecordObject = func(ctx context.Context, jobID, objectName string) error {
+		// A job deleted mid-run must not leave a reference behind; stop it like a cancellation.
+		err := jobdb.AddJobObject(ctx, db, jobID, objectName)
+		if errors.Is(err, jobdb.ErrJobNotFound) {
+			return cropper.ErrJobCancelled
+		}
+		return err
+	}
+
+	// Workers renew the lease of a running job every third of it; a claim not renewed within
+	// the lease is taken to belong to a crashed worker and the job is run again.
+	jobLease := time.Duration(envInt("JOB_LEASE_SECONDS", 900)) * time.Second
+	if jobLease <= 0 {
+		fatal("JOB_LEASE_SECONDS must be positive")
+	}
 
 	mux := http.NewServeMux()
 	health.Register(mux, func(ctx context.Context) error {
 		return db.PingContext(ctx)
 	})
-	mux.HandleFunc("/pubsub/jobs", func(w http.ResponseWriter, r *http.Request) {
+	switch mode := os.Getenv("WORKER_MODE"); mode {
+	case "", "push":
+		mux.Handle("/pubsub/jobs", requirePushToken(pushVerifier(), pushHandler(db, processor, jobLease)))
+	case "poll":
+		// Claim pending jobs straight from MySQL instead of from Pub/Sub. The publisher must still
+		// run (with PUBSUB_MODE=memory if there is no Pub/Sub): it delivers webhooks and deletions
+		// and marks the outbox rows jobs and reclaims queue as published, so retention clears them.
+		concurrency := envInt("WORKER_CONCURRENCY", 1)
+		if concurrency <= 0 {
+			fatal("WORKER_CONCURRENCY must be positive")
+		}
+		pollInterval := time.Second
+		if raw := os.Getenv("WORKER_POLL_INTERVAL"); raw != "" {
+			if v, err := strconv.ParseFloat(raw, 64); err == nil && v > 0 {
+				pollInterval = time.Duration(v * float64(time.Second))
+			}
+		}
+		slog.Info("worker polling for jobs", "concurrency", concurrency, "interval", pollInterval)
+		slog.Info("poll mode requires the publisher for webhooks, deletions and outbox cleanup")
+		for i := 0; i < concurrency; i++ {
+			go runPollLoop(context.Background(), db, processor, pollInterval, jobLease)
+		}
+	case "pull":
+		// Stream messages from a pull subscription, so the worker needs no public endpoint and
+		// processing time is bounded by MaxExtension rather than a push request timeout.
+		flow := broker.FlowControl{
+			MaxOutstandingMessages: envInt("WORKER_CONCURRENCY", 1),
+			MaxExtension:           time.Duration(envInt("PUBSUB_MAX_EXTENSION_SECONDS", 600)) * time.Second,
+		}
+		if flow.MaxOutstandingMessages <= 0 {
+			fatal("WORKER_CONCURRENCY must be positive")
+		}
+		subscriptionName := os.Getenv("PUBSUB_SUBSCRIPTION")
+		if subscriptionName == "" {
+			subscriptionName = "image-jobs-pull"
+		}
+		subscriber, closeSubscriber, err := broker.NewSubscriber(context.Background(), broker.ConfigFromEnv(), subscriptionName, flow)
+		if err != nil {
+			fatal("failed to configure pubsub subscriber", "err", err)
+		}
+		defer closeSubscriber()
+		slog.Info("worker pulling jobs", "subscription", subscriptionName, "max_outstanding", flow.MaxOutstandingMessages)
+		go func() {
+			if err := subscriber.Receive(context.Background(), pullHandler(db, processor, jobLease)); err != nil {
+				fatal("pubsub receive failed", "err", err)
+			}
+		}()
+	default:
+		fatal("unsupported WORKER_MODE", "mode", mode)
+	}
+
+	if local, ok := uploader.(*localstore.Uploader); ok && envBool("LOCAL_STORAGE_SERVE", true) {
+		// Serves crops and accepts PUTs to signed source upload URLs.
+		mux.Handle("/files/", http.StripPrefix("/files/", localstore.NewFileHandler(local, maxBytes)))
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	slog.Info("worker listening", "addr", ":"+port)
+	if err := http.ListenAndServe(":"+port, mux); err != nil {
+		fatal("worker server failed", "err", err)
+	}
+}
+
+func pushHandler(db *sql.DB, processor *cropper.Processor, lease time.Duration) http.HandlerFunc {
+	// Pub/Sub push endpoint: a non-2xx response makes Pub/Sub redeliver the message.
+	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -105,7 +180,7 @@ func main() {
 		}
 		slog.Info("received job message", "job_id", jobID)
 
-		claimed, err := jobdb.StartJob(db, jobID)
+		claimToken, claimed, err := jobdb.StartJob(db, jobID, lease)
 		if err != nil {
 			http.Error(w, "failed to start job", http.StatusInternalServerError)
 			return
@@ -126,121 +201,229 @@ func main() {
 			return
 		}
 
-		result, err := processor.Process(r.Context(), job.ID, job.Payload)
-		if err != nil {
-			if err := jobdb.FailJob(db, job.ID, err.Error()); err != nil {
-				slog.Error("failed to mark job failed", "job_id", job.ID, "err", err)
-			}
+		err = processJob(r.Context(), db, processor, job, claimToken, lease)
+		if errors.Is(err, errJobFailed) {
 			http.Error(w, "job failed", http.StatusInternalServerError)
 			return
 		}
-
-		if err := jobdb.CompleteJob(db, job.ID, result); err != nil {
-			slog.Error("failed to mark job done", "job_id", job.ID, "err", err)
+		if err != nil {
 			http.Error(w, "job completion failed", http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-	})
+	}
+}
+
+// verifyFunc checks the bearer token of a push request.
+type verifyFunc func(ctx context.Context, token string) error
 
-	if backend == "local" && localDir != "" && envBool("LOCAL_STORAGE_SERVE", true) {
-		fileServer := http.FileServer(http.Dir(localDir))
-		mux.Handle("/files/", http.StripPrefix("/files/", fileServer))
+func pushVerifier() verifyFunc {
+	// Pub/Sub push attaches a Google-signed OIDC token for the configured audience and push
+	// service account. Only the emulator, which signs nothing, may turn checking off.
+	if envBool("PUBSUB_AUTH_DISABLED", false) {
+		if mode := broker.ConfigFromEnv().Mode; mode != "emulator" {
+			fatal("PUBSUB_AUTH_DISABLED is only allowed with PUBSUB_MODE=emulator", "mode", mode)
+		}
+		slog.Warn("PUBSUB_AUTH_DISABLED is set; push requests are not authenticated")
+		return nil
+	}
+	audience := os.Getenv("PUBSUB_AUTH_AUDIENCE")
+	email := os.Getenv("PUBSUB_AUTH_EMAIL")
+	if audience == "" || email == "" {
+		fatal("push mode requires PUBSUB_AUTH_AUDIENCE and PUBSUB_AUTH_EMAIL")
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if path := os.Getenv("PUBSUB_AUTH_JWKS_FILE"); path != "" {
+		// Local testing: verify against keys from a JWKS file instead of Google's.
+		keys, err := oidc.LoadKeysFile(path)
+		if err != nil {
+			fatal("failed to load PUBSUB_AUTH_JWKS_FILE", "err", err)
+		}
+		issuers := oidc.GoogleIssuers
+		if raw := os.Getenv("PUBSUB_AUTH_ISSUERS"); raw != "" {
+			issuers = strings.Split(strings.ReplaceAll(raw, " ", ""), ",")
+		}
+		verifier := oidc.NewVerifier(keys, issuers, audience, email)
+		return func(ctx context.Context, token string) error {
+			_, err := verifier.Verify(ctx, token)
+			return err
+		}
 	}
-	slog.Info("worker listening", "addr", ":"+port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		fatal("worker server failed", "err", err)
+	return func(ctx context.Context, token string) error {
+		return validateGoogleToken(ctx, token, audience, email)
 	}
 }
 
-type jobProcessor struct {
-	httpClient  *http.Client
-	uploader    uploader.Uploader
-	limits      imageproc.Limits
-	jpegQuality int
+func validateGoogleToken(ctx context.Context, token, audience, email string) error {
+	// idtoken checks the signature, audience and expiry; issuer and email are left to us.
+	payload, err := idtoken.Validate(ctx, token, audience)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(oidc.GoogleIssuers, payload.Issuer) {
+		return fmt.Errorf("unexpected issuer %q", payload.Issuer)
+	}
+	verified, _ := payload.Claims["email_verified"].(bool)
+	if claimed, _ := payload.Claims["email"].(string); claimed != email || !verified {
+		return fmt.Errorf("unexpected email %q", claimed)
+	}
+	return nil
 }
 
-func newJobProcessor(client *http.Client, uploader uploader.Uploader, limits imageproc.Limits, quality int) *jobProcessor {
-	return &jobProcessor{
-		httpClient:  client,
-		uploader:    uploader,
-		limits:      limits,
-		jpegQuality: quality,
+func requirePushToken(verify verifyFunc, next http.Handler) http.Handler {
+	// Reject push requests without a valid bearer token; a nil verify lets everything through.
+	if verify == nil {
+		return next
 	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := oidc.BearerToken(r)
+		if err == nil {
+			err = verify(r.Context(), token)
+		}
+		if err != nil {
+			slog.Warn("rejected push request", "remote_addr", r.RemoteAddr, "err", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (p *jobProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) (json.RawMessage, error) {
-	// Download, crop, and upload the image, returning the result payload.
-	var req api.ImageCropRequest
-	if err := json.Unmarshal(payload, &req); err != nil {
-		return nil, err
-	}
-	if len(req.Images) == 0 {
-		return nil, errors.New("at least one image is required")
-	}
+func pullHandler(db *sql.DB, processor *cropper.Processor, lease time.Duration) broker.Handler {
+	// Ack once the job's outcome (done, failed or cancelled) is stored or there is nothing to do;
+	// nack when the database could not be updated, so Pub/Sub redelivers the message to a job
+	// processJob has put back to pending.
+	return func(ctx context.Context, msg broker.Message) error {
+		jobID, err := decodeJobPayload(msg.Data)
+		if err != nil {
+			slog.Warn("dropping invalid job message", "message_id", msg.ID, "err", err)
+			return nil
+		}
+		slog.Info("received job message", "job_id", jobID, "message_id", msg.ID)
 
-	var urls []string
-	for imageIdx, item := range req.Images {
-		if item.ImageUrl == "" {
-			return nil, errors.New("imageUrl is required")
+		claimToken, claimed, err := jobdb.StartJob(db, jobID, lease)
+		if err != nil {
+			return err
 		}
-		if len(item.CropAreas) == 0 {
-			return nil, errors.New("cropAreas is required")
+		if !claimed {
+			slog.Info("job already claimed", "job_id", jobID)
+			return nil
 		}
 
-		data, _, err := netfetch.Download(ctx, p.httpClient, item.ImageUrl, netfetch.Options{
-			MaxBytes: p.limits.MaxBytes,
-		})
+		job, ok, err := jobdb.GetJob(db, jobID)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !ok {
+			slog.Warn("job not found", "job_id", jobID)
+			return nil
 		}
 
-		img, err := imageproc.DecodeImage(data)
+		err = processJob(ctx, db, processor, job, claimToken, lease)
+		if errors.Is(err, errJobFailed) {
+			return nil
+		}
+		return err
+	}
+}
+
+func runPollLoop(ctx context.Context, db *sql.DB, processor *cropper.Processor, pollInterval, lease time.Duration) {
+	// Claim one pending job at a time (FOR UPDATE SKIP LOCKED keeps loops from colliding)
+	// and sleep only when the queue is empty or the claim failed.
+	for {
+		job, claimToken, ok, err := jobdb.ClaimJob(ctx, db, lease)
 		if err != nil {
-			return nil, err
+			slog.Error("job claim failed", "err", err)
+			time.Sleep(pollInterval)
+			continue
 		}
-		if err := imageproc.ValidateImage(img, p.limits.MaxPixels); err != nil {
-			return nil, err
+		if !ok {
+			time.Sleep(pollInterval)
+			continue
 		}
 
-		for cropIdx, area := range item.CropAreas {
-			cropped, err := imageproc.CropImage(img, imageproc.Crop{
-				X:      area.X,
-				Y:      area.Y,
-				Width:  area.Width,
-				Height: area.Height,
-			})
-			if err != nil {
-				return nil, err
-			}
+		slog.Info("claimed job", "job_id", job.ID)
+		if err := processJob(ctx, db, processor, job, claimToken, lease); err != nil && !errors.Is(err, errJobFailed) {
+			slog.Error("job outcome not recorded", "job_id", job.ID, "err", err)
+		}
+	}
+}
 
-			jpegBytes, err := imageproc.EncodeJPEG(cropped, p.jpegQuality)
-			if err != nil {
-				return nil, err
-			}
+func processJob(ctx context.Context, db *sql.DB, processor *cropper.Processor, job jobdb.Job, claimToken string, lease time.Duration) error {
+	// Run an in-progress job under its claim and store its outcome; returns errJobFailed when
+	// the job failed.
+	processCtx, stopProcessing := context.WithCancel(ctx)
+	defer stopProcessing()
+	stopHeartbeat := heartbeat(processCtx, db, job.ID, claimToken, lease, stopProcessing)
+	result, err := processor.Process(processCtx, job.ID, job.Payload)
+	stopHeartbeat()
+	if errors.Is(err, cropper.ErrJobCancelled) {
+		slog.Info("job cancelled during processing", "job_id", job.ID)
+		return nil
+	}
+	if err != nil && processCtx.Err() != nil && ctx.Err() == nil {
+		slog.Warn("job claim lost during processing", "job_id", job.ID)
+		return nil
+	}
+	if err != nil {
+		slog.Warn("job failed", "job_id", job.ID, "err", err)
+		if err := jobdb.FailJob(db, job.ID, claimToken, err.Error()); err != nil {
+			slog.Error("failed to mark job failed", "job_id", job.ID, "err", err)
+			return releaseJob(db, job.ID, claimToken, err)
+		}
+		return errJobFailed
+	}
+
+	if err := jobdb.CompleteJob(db, job.ID, claimToken, result); err != nil {
+		slog.Error("failed to mark job done", "job_id", job.ID, "err", err)
+		return releaseJob(db, job.ID, claimToken, err)
+	}
+	return nil
+}
 
-			objectName := fmt.Sprintf("crops/%s/%d_%d.jpg", jobID, imageIdx, cropIdx)
-			publicURL, err := p.uploader.Upload(ctx, objectName, jpegBytes, "image/jpeg")
-			if err != nil {
-				return nil, err
+func heartbeat(ctx context.Context, db *sql.DB, jobID, claimToken string, lease time.Duration, lost func()) (stop func()) {
+	// Renew the claim every third of the lease so long jobs are not taken over, and call lost
+	// once the claim is gone (cancelled or taken over) so the work stops. The returned stop
+	// waits for the renewal loop to exit.
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(max(lease/3, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				held, err := jobdb.RenewJob(ctx, db, jobID, claimToken)
+				if err != nil {
+					slog.Warn("failed to renew job claim", "job_id", jobID, "err", err)
+					continue
+				}
+				if !held {
+					lost()
+					return
+				}
 			}
-			urls = append(urls, publicURL)
 		}
+	}()
+	return func() {
+		close(done)
+		<-exited
 	}
+}
 
-	if len(urls) == 0 {
-		return nil, errors.New("no cropped images generated")
+func releaseJob(db *sql.DB, jobID, claimToken string, cause error) error {
+	// A job whose outcome was not stored goes back to pending, so the redelivery (or the next
+	// poll) runs it again instead of finding it in_progress and dropping it. Returns cause.
+	if err := jobdb.ReleaseJob(db, jobID, claimToken); err != nil {
+		slog.Error("failed to release job", "job_id", jobID, "err", err)
 	}
-
-	return json.Marshal(map[string]any{
-		"croppedImageUrls": urls,
-	})
+	return cause
 }
 
 type pubSubEnvelope struct {
@@ -254,6 +437,10 @@ func decodeJobID(envelope pubSubEnvelope) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return decodeJobPayload(raw)
+}
+
+func decodeJobPayload(raw []byte) (string, error) {
 	var payload struct {
 		JobID string `json:"jobId"`
 	}
@@ -266,7 +453,10 @@ func decodeJobID(envelope pubSubEnvelope) (string, error) {
 	return payload.JobID, nil
 }
 
-var errMissingJobID = errors.New("jobId is required")
+var (
+	errMissingJobID = errors.New("jobId is required")
+	errJobFailed    = errors.New("job failed")
+)
 
 func fatal(msg string, attrs ...any) {
 	slog.Error(msg, attrs...)
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"image-api/internal/broker"
+	"image-api/internal/cropper"
+	"image-api/internal/imageproc"
+	"image-api/internal/netfetch"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func newFakeSubscription(t *testing.T) (*pstest.Server, *pubsub.Topic, *pubsub.Subscription) {
+	t.Helper()
+	srv := pstest.NewServer()
+	t.Cleanup(func() { _ = srv.Close() })
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial fake pubsub: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client, err := pubsub.NewClient(context.Background(), "test-project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("pubsub client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx := context.Background()
+	topic, err := client.CreateTopic(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("create topic: %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "jobs-pull", pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	sub.ReceiveSettings.MaxOutstandingMessages = 1
+	return srv, topic, sub
+}
+
+func expectClaimAndFetch(mock sqlmock.Sqlmock, jobID string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET status = 'in_progress'`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), jobID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, status, payload, result, error, attempts, created_at, updated_at`)).
+		WithArgs(jobID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "payload", "result", "error", "attempts", "created_at", "updated_at"}).
+			AddRow(jobID, "in_progress", `{"images":[]}`, nil, nil, 1, "2026-01-01T00:00:00Z", "2026-01-01T00:00:00Z"))
+}
+
+func TestPullHandlerRetriesJobWhoseOutcomeWasNotStored(t *testing.T) {
+	const jobID = "7f1f5c1e-2d7e-4a53-9f52-8f0c0c1b7e11"
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// First delivery: the job fails but storing that fails too, so it goes back to pending.
+	expectClaimAndFetch(mock, jobID)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET status = 'failed'`)).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET status = 'pending'`)).
+		WithArgs(sqlmock.AnyArg(), jobID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Redelivery: the job is claimed again and its failure is stored.
+	expectClaimAndFetch(mock, jobID)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET status = 'failed'`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, status, payload, result, error, attempts, created_at, updated_at`)).
+		WithArgs(jobID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "payload", "result", "error", "attempts", "created_at", "updated_at"}).
+			AddRow(jobID, "failed", `{"images":[]}`, nil, "at least one image is required", 1, "2026-01-01T00:00:00Z", "2026-01-01T00:00:01Z"))
+	mock.ExpectCommit()
+
+	srv, topic, sub := newFakeSubscription(t)
+	ctx := context.Background()
+	if _, err := topic.Publish(ctx, &pubsub.Message{Data: []byte(`{"jobId":"` + jobID + `"}`)}).Get(ctx); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	topic.Stop()
+
+	processor := cropper.NewProcessor(http.DefaultClient, nil, imageproc.Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}, 90, netfetch.HostPolicy{}, nil)
+	handler := pullHandler(db, processor, 15*time.Minute)
+	receiveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var (
+		mu         sync.Mutex
+		deliveries int
+	)
+	err = broker.NewPubSubSubscriber(sub).Receive(receiveCtx, func(ctx context.Context, msg broker.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries++
+		err := handler(ctx, msg)
+		if err == nil {
+			cancel()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+	msgs := srv.Messages()
+	if deliveries != 2 || len(msgs) != 1 || msgs[0].Acks != 1 {
+		t.Fatalf("expected a nack, a redelivery and one ack, got %d deliveries: %+v", deliveries, msgs)
+	}
+}
+
+func TestHeartbeatReportsLostClaim(t *testing.T) {
+	const (
+		jobID      = "7f1f5c1e-2d7e-4a53-9f52-8f0c0c1b7e11"
+		claimToken = "c4a1f0de-3b7e-4f5e-9d61-2f9e8b7a6c55"
+	)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// The first renewal extends the lease; by the second the job was taken over.
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET claimed_at = ?`)).
+		WithArgs(sqlmock.AnyArg(), jobID, claimToken).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET claimed_at = ?`)).
+		WithArgs(sqlmock.AnyArg(), jobID, claimToken).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM jobs WHERE id = ? AND status = 'in_progress' AND claim_token = ?`)).
+		WithArgs(jobID, claimToken).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	lost := make(chan struct{})
+	stop := heartbeat(context.Background(), db, jobID, claimToken, 3*time.Second, func() { close(lost) })
+	defer stop()
+	select {
+	case <-lost:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("lost claim was not reported")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
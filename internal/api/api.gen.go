@@ -6,12 +6,101 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/oapi-codegen/runtime"
 	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
+// Defines values for CreateUploadRequestContentType.
+const (
+	ImageGif  CreateUploadRequestContentType = "image/gif"
+	ImageJpeg CreateUploadRequestContentType = "image/jpeg"
+	ImagePng  CreateUploadRequestContentType = "image/png"
+	ImageTiff CreateUploadRequestContentType = "image/tiff"
+	ImageWebp CreateUploadRequestContentType = "image/webp"
+)
+
+// Defines values for OutputFormat.
+const (
+	Gif  OutputFormat = "gif"
+	Jpeg OutputFormat = "jpeg"
+	Png  OutputFormat = "png"
+	Tiff OutputFormat = "tiff"
+	Webp OutputFormat = "webp"
+)
+
+// Defines values for OutputMetadata.
+const (
+	Icc      OutputMetadata = "icc"
+	Preserve OutputMetadata = "preserve"
+	Strip    OutputMetadata = "strip"
+)
+
+// Defines values for OutputPngCompression.
+const (
+	Best    OutputPngCompression = "best"
+	Default OutputPngCompression = "default"
+	Fast    OutputPngCompression = "fast"
+	None    OutputPngCompression = "none"
+)
+
+// Defines values for ResizeFilter.
+const (
+	Box        ResizeFilter = "box"
+	Catmullrom ResizeFilter = "catmullrom"
+	Lanczos    ResizeFilter = "lanczos"
+	Linear     ResizeFilter = "linear"
+	Mitchell   ResizeFilter = "mitchell"
+	Nearest    ResizeFilter = "nearest"
+)
+
+// Defines values for ResizeFit.
+const (
+	Contain ResizeFit = "contain"
+	Cover   ResizeFit = "cover"
+	Fill    ResizeFit = "fill"
+	Inside  ResizeFit = "inside"
+)
+
+// Defines values for SyncCropRequestResponse.
+const (
+	Image SyncCropRequestResponse = "image"
+	Urls  SyncCropRequestResponse = "urls"
+)
+
+// Defines values for GetJobsParamsStatus.
+const (
+	Cancelled  GetJobsParamsStatus = "cancelled"
+	Done       GetJobsParamsStatus = "done"
+	Failed     GetJobsParamsStatus = "failed"
+	InProgress GetJobsParamsStatus = "in_progress"
+	Pending    GetJobsParamsStatus = "pending"
+)
+
+// CreateUploadRequest defines model for CreateUploadRequest.
+type CreateUploadRequest struct {
+	ContentType CreateUploadRequestContentType `json:"contentType"`
+}
+
+// CreateUploadRequestContentType defines model for CreateUploadRequest.ContentType.
+type CreateUploadRequestContentType string
+
+// CropArea defines model for CropArea.
+type CropArea struct {
+	Height int `json:"height"`
+
+	// Output Output encoding for the crop; defaults to JPEG.
+	Output *Output `json:"output,omitempty"`
+
+	// Resize Optional scale step applied after cropping.
+	Resize *Resize `json:"resize,omitempty"`
+	Width  int     `json:"width"`
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+}
+
 // ErrorResponse defines model for ErrorResponse.
 type ErrorResponse struct {
 	Message string `json:"message"`
@@ -19,20 +108,33 @@ type ErrorResponse struct {
 
 // ImageCropRequest defines model for ImageCropRequest.
 type ImageCropRequest struct {
-	Images []struct {
-		CropAreas []struct {
-			Height int `json:"height"`
-			Width  int `json:"width"`
-			X      int `json:"x"`
-			Y      int `json:"y"`
-		} `json:"cropAreas"`
-		ImageUrl string `json:"imageUrl"`
+	// CallbackUrl Receives a signed POST when the job reaches done or failed.
+	CallbackUrl *string `json:"callbackUrl,omitempty"`
+	Images      []struct {
+		CropAreas []CropArea `json:"cropAreas"`
+		ImageUrl  *string    `json:"imageUrl,omitempty"`
+
+		// SourceObject Storage object holding an uploaded source image; set by the server, the worker reads it instead of fetching imageUrl.
+		SourceObject *string `json:"sourceObject,omitempty"`
+
+		// UploadId ID from POST /uploads whose signed URL received the image.
+		UploadId *openapi_types.UUID `json:"uploadId,omitempty"`
 	} `json:"images"`
 }
 
+// JobListResponse defines model for JobListResponse.
+type JobListResponse struct {
+	Jobs       []JobResponse `json:"jobs"`
+	NextCursor *string       `json:"nextCursor"`
+}
+
 // JobResponse defines model for JobResponse.
 type JobResponse struct {
-	CreatedAt        string             `json:"created_at"`
+	// Attempts Processing attempts, starting at 1 and incremented by each retry.
+	Attempts  int    `json:"attempts"`
+	CreatedAt string `json:"created_at"`
+
+	// CroppedImageUrls Result URLs; signed and expiring when the API runs in private mode.
 	CroppedImageUrls *[]string          `json:"croppedImageUrls,omitempty"`
 	Error            *string            `json:"error"`
 	Id               openapi_types.UUID `json:"id"`
@@ -40,37 +142,230 @@ type JobResponse struct {
 	UpdatedAt        string             `json:"updated_at"`
 }
 
+// Output Output encoding for the crop; defaults to JPEG.
+type Output struct {
+	// Format WebP output is always lossless.
+	Format *OutputFormat `json:"format,omitempty"`
+
+	// Metadata Source metadata to keep in JPEG/PNG output; icc keeps only the color profile.
+	Metadata       *OutputMetadata       `json:"metadata,omitempty"`
+	PngCompression *OutputPngCompression `json:"pngCompression,omitempty"`
+
+	// Quality JPEG quality; defaults to the worker's configured quality.
+	Quality *int `json:"quality,omitempty"`
+}
+
+// OutputFormat WebP output is always lossless.
+type OutputFormat string
+
+// OutputMetadata Source metadata to keep in JPEG/PNG output; icc keeps only the color profile.
+type OutputMetadata string
+
+// OutputPngCompression defines model for Output.PngCompression.
+type OutputPngCompression string
+
+// Resize Optional scale step applied after cropping.
+type Resize struct {
+	Filter *ResizeFilter `json:"filter,omitempty"`
+	Fit    *ResizeFit    `json:"fit,omitempty"`
+
+	// Height Target height; 0 or omitted keeps the aspect ratio from width.
+	Height *int `json:"height,omitempty"`
+
+	// Width Target width; 0 or omitted keeps the aspect ratio from height.
+	Width *int `json:"width,omitempty"`
+}
+
+// ResizeFilter defines model for Resize.Filter.
+type ResizeFilter string
+
+// ResizeFit defines model for Resize.Fit.
+type ResizeFit string
+
+// SyncCropRequest defines model for SyncCropRequest.
+type SyncCropRequest struct {
+	CropAreas []CropArea `json:"cropAreas"`
+	ImageUrl  string     `json:"imageUrl"`
+
+	// Response image returns the encoded bytes of a single crop; urls uploads every crop and returns their URLs.
+	Response *SyncCropRequestResponse `json:"response,omitempty"`
+}
+
+// SyncCropRequestResponse image returns the encoded bytes of a single crop; urls uploads every crop and returns their URLs.
+type SyncCropRequestResponse string
+
+// SyncCropResponse defines model for SyncCropResponse.
+type SyncCropResponse struct {
+	CroppedImageUrls []string `json:"croppedImageUrls"`
+}
+
+// UploadResponse defines model for UploadResponse.
+type UploadResponse struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Headers Headers the client must send unchanged with the upload request.
+	Headers   map[string]string  `json:"headers"`
+	Method    string             `json:"method"`
+	UploadId  openapi_types.UUID `json:"uploadId"`
+	UploadUrl string             `json:"uploadUrl"`
+}
+
+// GetJobsParams defines parameters for GetJobs.
+type GetJobsParams struct {
+	Status *GetJobsParamsStatus `form:"status,omitempty" json:"status,omitempty"`
+
+	// CreatedAfter Only jobs created at or after this time.
+	CreatedAfter *time.Time `form:"createdAfter,omitempty" json:"createdAfter,omitempty"`
+
+	// CreatedBefore Only jobs created before this time.
+	CreatedBefore  *time.Time `form:"createdBefore,omitempty" json:"createdBefore,omitempty"`
+	IdempotencyKey *string    `form:"idempotencyKey,omitempty" json:"idempotencyKey,omitempty"`
+	Limit          *int       `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor Opaque nextCursor from a previous page.
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+}
+
+// GetJobsParamsStatus defines parameters for GetJobs.
+type GetJobsParamsStatus string
+
+// GetJobsIdParams defines parameters for GetJobsId.
+type GetJobsIdParams struct {
+	// Wait Long-poll for up to this duration (e.g. 30s, max 60s) while the job is pending or in_progress.
+	Wait *string `form:"wait,omitempty" json:"wait,omitempty"`
+}
+
 // PostJobsImageCropParams defines parameters for PostJobsImageCrop.
 type PostJobsImageCropParams struct {
 	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
 }
 
+// PostJobsImageCropUploadMultipartBody defines parameters for PostJobsImageCropUpload.
+type PostJobsImageCropUploadMultipartBody struct {
+	CallbackUrl *string `json:"callbackUrl,omitempty"`
+
+	// CropAreas JSON array of CropArea.
+	CropAreas string             `json:"cropAreas"`
+	Image     openapi_types.File `json:"image"`
+}
+
+// PostJobsImageCropUploadParams defines parameters for PostJobsImageCropUpload.
+type PostJobsImageCropUploadParams struct {
+	// CropAreas JSON array of CropArea; required when the body is a raw image.
+	CropAreas *string `form:"cropAreas,omitempty" json:"cropAreas,omitempty"`
+
+	// CallbackUrl Webhook target when the body is a raw image.
+	CallbackUrl    *string `form:"callbackUrl,omitempty" json:"callbackUrl,omitempty"`
+	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
+}
+
+// PostCropJSONRequestBody defines body for PostCrop for application/json ContentType.
+type PostCropJSONRequestBody = SyncCropRequest
+
 // PostJobsImageCropJSONRequestBody defines body for PostJobsImageCrop for application/json ContentType.
 type PostJobsImageCropJSONRequestBody = ImageCropRequest
 
+// PostUploadsJSONRequestBody defines body for PostUploads for application/json ContentType.
+type PostUploadsJSONRequestBody = CreateUploadRequest
+
+// PostJobsImageCropUploadMultipartRequestBody defines body for PostJobsImageCropUpload for multipart/form-data ContentType.
+type PostJobsImageCropUploadMultipartRequestBody PostJobsImageCropUploadMultipartBody
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// Crop a small image synchronously
+	// (POST /crop)
+	PostCrop(w http.ResponseWriter, r *http.Request)
+	// List jobs
+	// (GET /jobs)
+	GetJobs(w http.ResponseWriter, r *http.Request, params GetJobsParams)
 	// Create an image-crop job
 	// (POST /jobs/image-crop)
 	PostJobsImageCrop(w http.ResponseWriter, r *http.Request, params PostJobsImageCropParams)
+	// Create an image-crop job from an uploaded image
+	// (POST /jobs/image-crop/upload)
+	PostJobsImageCropUpload(w http.ResponseWriter, r *http.Request, params PostJobsImageCropUploadParams)
+	// Delete a job and its stored crops
+	// (DELETE /jobs/{id})
+	DeleteJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID)
 	// Get job status
 	// (GET /jobs/{id})
-	GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID)
+	GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID, params GetJobsIdParams)
+	// Cancel a pending or in-progress job
+	// (POST /jobs/{id}/cancel)
+	PostJobsIdCancel(w http.ResponseWriter, r *http.Request, id openapi_types.UUID)
+	// Stream job status as Server-Sent Events
+	// (GET /jobs/{id}/events)
+	GetJobsIdEvents(w http.ResponseWriter, r *http.Request, id openapi_types.UUID)
+	// Retry a failed job
+	// (POST /jobs/{id}/retry)
+	PostJobsIdRetry(w http.ResponseWriter, r *http.Request, id openapi_types.UUID)
+	// Get a signed URL to upload a source image directly to storage
+	// (POST /uploads)
+	PostUploads(w http.ResponseWriter, r *http.Request)
 }
 
 // Unimplemented server implementation that returns http.StatusNotImplemented for each endpoint.
 
 type Unimplemented struct{}
 
+// Crop a small image synchronously
+// (POST /crop)
+func (_ Unimplemented) PostCrop(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// List jobs
+// (GET /jobs)
+func (_ Unimplemented) GetJobs(w http.ResponseWriter, r *http.Request, params GetJobsParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
 // Create an image-crop job
 // (POST /jobs/image-crop)
 func (_ Unimplemented) PostJobsImageCrop(w http.ResponseWriter, r *http.Request, params PostJobsImageCropParams) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
 
+// Create an image-crop job from an uploaded image
+// (POST /jobs/image-crop/upload)
+func (_ Unimplemented) PostJobsImageCropUpload(w http.ResponseWriter, r *http.Request, params PostJobsImageCropUploadParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Delete a job and its stored crops
+// (DELETE /jobs/{id})
+func (_ Unimplemented) DeleteJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
 // Get job status
 // (GET /jobs/{id})
-func (_ Unimplemented) GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+func (_ Unimplemented) GetJobsId(w http.ResponseWriter, r *http.Request, id openapi_types.UUID, params GetJobsIdParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Cancel a pending or in-progress job
+// (POST /jobs/{id}/cancel)
+func (_ Unimplemented) PostJobsIdCancel(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Stream job status as Server-Sent Events
+// (GET /jobs/{id}/events)
+func (_ Unimplemented) GetJobsIdEvents(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Retry a failed job
+// (POST /jobs/{id}/retry)
+func (_ Unimplemented) PostJobsIdRetry(w http.ResponseWriter, r *http.Request, id openapi_types.UUID) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Get a signed URL to upload a source image directly to storage
+// (POST /uploads)
+func (_ Unimplemented) PostUploads(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
 
@@ -83,6 +378,89 @@ type ServerInterfaceWrapper struct {
 
 type MiddlewareFunc func(http.Handler) http.Handler
 
+// PostCrop operation middleware
+func (siw *ServerInterfaceWrapper) PostCrop(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostCrop(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetJobs operation middleware
+func (siw *ServerInterfaceWrapper) GetJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetJobsParams
+
+	// ------------- Optional query parameter "status" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "status", r.URL.Query(), &params.Status)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "status", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "createdAfter" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdAfter", r.URL.Query(), &params.CreatedAfter)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "createdAfter", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "createdBefore" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdBefore", r.URL.Query(), &params.CreatedBefore)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "createdBefore", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "idempotencyKey" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "idempotencyKey", r.URL.Query(), &params.IdempotencyKey)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "idempotencyKey", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobs(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // PostJobsImageCrop operation middleware
 func (siw *ServerInterfaceWrapper) PostJobsImageCrop(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -124,6 +502,89 @@ func (siw *ServerInterfaceWrapper) PostJobsImageCrop(w http.ResponseWriter, r *h
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// PostJobsImageCropUpload operation middleware
+func (siw *ServerInterfaceWrapper) PostJobsImageCropUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostJobsImageCropUploadParams
+
+	// ------------- Optional query parameter "cropAreas" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cropAreas", r.URL.Query(), &params.CropAreas)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cropAreas", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "callbackUrl" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "callbackUrl", r.URL.Query(), &params.CallbackUrl)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "callbackUrl", Err: err})
+		return
+	}
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "Idempotency-Key", runtime.ParamLocationHeader, valueList[0], &IdempotencyKey)
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostJobsImageCropUpload(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DeleteJobsId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteJobsId(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, chi.URLParam(r, "id"), &id)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteJobsId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetJobsId operation middleware
 func (siw *ServerInterfaceWrapper) GetJobsId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -139,8 +600,112 @@ func (siw *ServerInterfaceWrapper) GetJobsId(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetJobsIdParams
+
+	// ------------- Optional query parameter "wait" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "wait", r.URL.Query(), &params.Wait)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "wait", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobsId(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// PostJobsIdCancel operation middleware
+func (siw *ServerInterfaceWrapper) PostJobsIdCancel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, chi.URLParam(r, "id"), &id)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetJobsId(w, r, id)
+		siw.Handler.PostJobsIdCancel(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetJobsIdEvents operation middleware
+func (siw *ServerInterfaceWrapper) GetJobsIdEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, chi.URLParam(r, "id"), &id)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobsIdEvents(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// PostJobsIdRetry operation middleware
+func (siw *ServerInterfaceWrapper) PostJobsIdRetry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id openapi_types.UUID
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "id", runtime.ParamLocationPath, chi.URLParam(r, "id"), &id)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostJobsIdRetry(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// PostUploads operation middleware
+func (siw *ServerInterfaceWrapper) PostUploads(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostUploads(w, r)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -263,12 +828,36 @@ func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handl
 		ErrorHandlerFunc:   options.ErrorHandlerFunc,
 	}
 
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/crop", wrapper.PostCrop)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/jobs", wrapper.GetJobs)
+	})
 	r.Group(func(r chi.Router) {
 		r.Post(options.BaseURL+"/jobs/image-crop", wrapper.PostJobsImageCrop)
 	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/jobs/image-crop/upload", wrapper.PostJobsImageCropUpload)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/jobs/{id}", wrapper.DeleteJobsId)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/jobs/{id}", wrapper.GetJobsId)
 	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/jobs/{id}/cancel", wrapper.PostJobsIdCancel)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/jobs/{id}/events", wrapper.GetJobsIdEvents)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/jobs/{id}/retry", wrapper.PostJobsIdRetry)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/uploads", wrapper.PostUploads)
+	})
 
 	return r
 }
@@ -0,0 +1,336 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+const (
+	apiVersion       = "2021-08-06"
+	defaultURLExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	ErrContainerRequired  = errors.New("container is required")
+	ErrAccountKeyRequired = errors.New("account key is required to sign URLs")
+	ErrRequestFailed      = errors.New("azure blob request failed")
+)
+
+// Credentials authenticate either with the base64 account key (Shared Key) or a SAS token.
+// Only the account key can mint SAS URLs.
+type Credentials struct {
+	AccountKey string
+	SASToken   string
+}
+
+// Uploader stores block blobs in an Azure Storage container via the Blob REST API.
+type Uploader struct {
+	Client    *http.Client
+	Endpoint  string
+	Account   string
+	Container string
+	// Public returns plain blob URLs; otherwise Upload returns read-only SAS URLs valid for URLExpiry.
+	Public    bool
+	URLExpiry time.Duration
+
+	key      []byte
+	sasToken string
+	now      func() time.Time
+}
+
+// NewUploader defaults the endpoint to https://<account>.blob.core.windows.net when empty.
+func NewUploader(client *http.Client, endpoint, account, container string, creds Credentials, public bool) (*Uploader, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	u := &Uploader{
+		Client:    client,
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Account:   account,
+		Container: container,
+		Public:    public,
+		URLExpiry: defaultURLExpiry,
+		sasToken:  strings.TrimPrefix(creds.SASToken, "?"),
+		now:       time.Now,
+	}
+	if creds.AccountKey != "" {
+		key, err := base64.StdEncoding.DecodeString(creds.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode account key: %w", err)
+		}
+		u.key = key
+	}
+	if !public && u.key == nil {
+		return nil, fmt.Errorf("%w: private containers need SAS URLs", ErrAccountKeyRequired)
+	}
+	return u, nil
+}
+
+func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
+	// PUT a block blob, returning its public or SAS URL.
+	resp, target, err := u.do(ctx, http.MethodPut, objectName, data, func(req *http.Request) {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", responseError(resp)
+	}
+
+	return u.resultURL(target, objectName), nil
+}
+
+func (u *Uploader) URL(ctx context.Context, objectName string) (string, error) {
+	target, err := u.blobURL(objectName)
+	if err != nil {
+		return "", err
+	}
+	return u.resultURL(target, objectName), nil
+}
+
+func (u *Uploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	resp, _, err := u.do(ctx, http.MethodGet, objectName, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Stat uses Get Blob Properties; Put Blob stores the content MD5, reported base64-encoded.
+func (u *Uploader) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	resp, _, err := u.do(ctx, http.MethodHead, objectName, nil, nil)
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return uploader.ObjectInfo{}, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if resp.StatusCode/100 != 2 {
+		return uploader.ObjectInfo{}, responseError(resp)
+	}
+
+	var checksum string
+	if sum, err := base64.StdEncoding.DecodeString(resp.Header.Get("Content-MD5")); err == nil {
+		checksum = hex.EncodeToString(sum)
+	}
+	return uploader.ObjectInfo{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		Checksum:    checksum,
+	}, nil
+}
+
+func (u *Uploader) Delete(ctx context.Context, objectName string) error {
+	resp, _, err := u.do(ctx, http.MethodDelete, objectName, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+type enumerationResults struct {
+	Blobs struct {
+		Blob []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// List pages through List Blobs for every blob under prefix.
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	target, err := u.containerURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var marker string
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		target.RawQuery = query.Encode()
+
+		resp, err := u.send(ctx, http.MethodGet, target, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			err := responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page enumerationResults
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode list response: %w", err)
+		}
+
+		for _, blob := range page.Blobs.Blob {
+			names = append(names, blob.Name)
+		}
+		if page.NextMarker == "" {
+			return names, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// SignURL mints a service SAS for the blob. Azure cannot bound the size of a SAS PUT,
+// so opts.MaxBytes is left to readers of the blob to enforce.
+func (u *Uploader) SignURL(ctx context.Context, objectName string, opts uploader.SignOptions) (uploader.SignedURL, error) {
+	_ = ctx
+	if u.key == nil {
+		return uploader.SignedURL{}, uploader.ErrSigningNotConfigured
+	}
+	target, err := u.blobURL(objectName)
+	if err != nil {
+		return uploader.SignedURL{}, err
+	}
+
+	permissions := "r"
+	headers := map[string]string{}
+	if opts.Method == http.MethodPut {
+		permissions = "cw"
+		headers["x-ms-blob-type"] = "BlockBlob"
+	}
+	if opts.ContentType != "" {
+		headers["Content-Type"] = opts.ContentType
+	}
+	return uploader.SignedURL{
+		URL:     u.sasURL(target, objectName, permissions, opts.Expires),
+		Headers: headers,
+	}, nil
+}
+
+func (u *Uploader) do(ctx context.Context, method, objectName string, body []byte, prepare func(*http.Request)) (*http.Response, *url.URL, error) {
+	// Send an authorized request for one blob; prepare sets extra headers before signing.
+	if objectName == "" {
+		return nil, nil, errors.New("object name is required")
+	}
+	target, err := u.blobURL(objectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := u.send(ctx, method, target, body, prepare)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, target, nil
+}
+
+func (u *Uploader) send(ctx context.Context, method string, target *url.URL, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	u.authorize(req)
+	return u.Client.Do(req)
+}
+
+func (u *Uploader) containerURL() (*url.URL, error) {
+	if u.Container == "" {
+		return nil, ErrContainerRequired
+	}
+	endpoint, err := url.Parse(u.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid blob endpoint %q", u.Endpoint)
+	}
+	target := *endpoint
+	target.Path = endpoint.Path + "/" + u.Container
+	target.RawPath = ""
+	return &target, nil
+}
+
+func (u *Uploader) blobURL(objectName string) (*url.URL, error) {
+	target, err := u.containerURL()
+	if err != nil {
+		return nil, err
+	}
+	target.Path += "/" + strings.TrimPrefix(objectName, "/")
+	return target, nil
+}
+
+func (u *Uploader) resultURL(target *url.URL, objectName string) string {
+	// Public containers get plain blob URLs, private ones a read-only SAS.
+	if u.Public {
+		return target.String()
+	}
+	return u.sasURL(target, objectName, "r", u.URLExpiry)
+}
+
+func (u *Uploader) authorize(req *http.Request) {
+	// Shared Key when an account key is set, otherwise append the SAS token.
+	req.Header.Set("x-ms-date", u.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", apiVersion)
+	if u.key != nil {
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", u.Account, u.sharedKeySignature(req)))
+		return
+	}
+	if u.sasToken != "" {
+		if req.URL.RawQuery != "" {
+			req.URL.RawQuery += "&"
+		}
+		req.URL.RawQuery += u.sasToken
+	}
+}
+
+type blobError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var parsed blobError
+	if xml.Unmarshal(body, &parsed) == nil && parsed.Code != "" {
+		return fmt.Errorf("%w: status %d: %s: %s", ErrRequestFailed, resp.StatusCode, parsed.Code, strings.TrimSpace(parsed.Message))
+	}
+	if code := resp.Header.Get("x-ms-error-code"); code != "" {
+		return fmt.Errorf("%w: status %d: %s", ErrRequestFailed, resp.StatusCode, code)
+	}
+	return fmt.Errorf("%w: status %d", ErrRequestFailed, resp.StatusCode)
+}
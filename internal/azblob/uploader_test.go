@@ -0,0 +1,171 @@
+package azblob
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("account-key"))
+
+// fakeBlob stands in for the Blob service, checking Shared Key or a fixed SAS token.
+type fakeBlob struct {
+	verifier *Uploader
+	sasToken string
+
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (f *fakeBlob) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var authorized bool
+	if f.sasToken != "" {
+		authorized = r.URL.RawQuery == f.sasToken
+	} else {
+		authorized = r.Header.Get("Authorization") == "SharedKey acct:"+f.verifier.sharedKeySignature(r)
+	}
+	if !authorized {
+		w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.blobs[r.URL.Path] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<?xml version=\"1.0\"?><Error><Code>BlobNotFound</Code><Message>missing</Message></Error>")
+			return
+		}
+		sum := md5.Sum(body)
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+	case http.MethodDelete:
+		if _, ok := f.blobs[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func TestSharedKeyUploadAndOpen(t *testing.T) {
+	verifier, _ := NewUploader(nil, "", "acct", "images", Credentials{AccountKey: testKey}, true)
+	fake := &fakeBlob{verifier: verifier, blobs: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, err := NewUploader(server.Client(), server.URL+"/acct", "acct", "images", Credentials{AccountKey: testKey}, true)
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	blobURL, err := u.Upload(context.Background(), "crops/job/0_0.png", []byte("data"), "image/png")
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if blobURL != server.URL+"/acct/images/crops/job/0_0.png" {
+		t.Fatalf("unexpected url: %s", blobURL)
+	}
+
+	reader, err := u.Open(context.Background(), "crops/job/0_0.png")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "data" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	if _, err := u.Open(context.Background(), "crops/missing.png"); !errors.Is(err, uploader.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	info, err := u.Stat(context.Background(), "crops/job/0_0.png")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size != 4 || info.Checksum != "8d777f385d3dfec8815d20f7496026dc" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	for i := 0; i < 2; i++ {
+		// The second delete hits a missing blob, which is not an error.
+		if err := u.Delete(context.Background(), "crops/job/0_0.png"); err != nil {
+			t.Fatalf("delete %d: %v", i, err)
+		}
+	}
+	if _, err := u.Stat(context.Background(), "crops/job/0_0.png"); !errors.Is(err, uploader.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	wrongKey, _ := NewUploader(server.Client(), server.URL+"/acct", "acct", "images", Credentials{AccountKey: base64.StdEncoding.EncodeToString([]byte("other"))}, true)
+	if _, err := wrongKey.Upload(context.Background(), "a.png", []byte("x"), "image/png"); !errors.Is(err, ErrRequestFailed) || !strings.Contains(err.Error(), "AuthenticationFailed") {
+		t.Fatalf("expected AuthenticationFailed, got %v", err)
+	}
+}
+
+func TestSASTokenUpload(t *testing.T) {
+	fake := &fakeBlob{sasToken: "sv=2021-08-06&sig=abc", blobs: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, err := NewUploader(server.Client(), server.URL, "acct", "images", Credentials{SASToken: "?sv=2021-08-06&sig=abc"}, true)
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	if _, err := u.Upload(context.Background(), "a.png", []byte("x"), "image/png"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := u.SignURL(context.Background(), "a.png", uploader.SignOptions{Method: http.MethodGet}); !errors.Is(err, uploader.ErrSigningNotConfigured) {
+		t.Fatalf("expected ErrSigningNotConfigured, got %v", err)
+	}
+	if _, err := NewUploader(nil, "", "acct", "images", Credentials{SASToken: "sig=abc"}, false); !errors.Is(err, ErrAccountKeyRequired) {
+		t.Fatalf("expected ErrAccountKeyRequired, got %v", err)
+	}
+}
+
+func TestPrivateUploadReturnsSASURL(t *testing.T) {
+	verifier, _ := NewUploader(nil, "", "acct", "images", Credentials{AccountKey: testKey}, true)
+	server := httptest.NewServer(&fakeBlob{verifier: verifier, blobs: map[string][]byte{}})
+	defer server.Close()
+
+	u, _ := NewUploader(server.Client(), server.URL+"/acct", "acct", "images", Credentials{AccountKey: testKey}, false)
+	u.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	u.URLExpiry = time.Hour
+
+	blobURL, err := u.Upload(context.Background(), "a.png", []byte("x"), "image/png")
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	parsed, _ := url.Parse(blobURL)
+	query := parsed.Query()
+	if query.Get("sp") != "r" || query.Get("sr") != "b" || query.Get("se") != "2024-01-01T01:00:00Z" || query.Get("sig") == "" {
+		t.Fatalf("unexpected SAS query: %s", parsed.RawQuery)
+	}
+}
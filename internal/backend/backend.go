@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"image-api/internal/azblob"
+	"image-api/internal/gcs"
+	"image-api/internal/localstore"
+	"image-api/internal/s3"
+	"image-api/internal/uploader"
+
+	"cloud.google.com/go/storage"
+)
+
+var (
+	ErrUnknownBackend         = errors.New("unknown upload backend")
+	ErrPrivateResultsRequired = errors.New("private results required")
+)
+
+// Config selects the storage backend behind uploader.Uploader.
+type Config struct {
+	Backend          string
+	Private          bool
+	GCSBucket        string
+	GCSPublic        bool
+	GCSSkipACLErrors bool
+	LocalDir         string
+	LocalBaseURL     string
+	LocalSigningKey  string
+	S3Bucket         string
+	S3Region         string
+	S3Endpoint       string
+	S3PathStyle      bool
+	S3PublicBaseURL  string
+	S3Credentials    s3.Credentials
+	AzureAccount     string
+	AzureContainer   string
+	AzureEndpoint    string
+	AzurePublic      bool
+	AzureURLExpiry   time.Duration
+	AzureCredentials azblob.Credentials
+	// HTTPTimeout bounds each request to the S3 and Azure APIs, including the body transfer.
+	HTTPTimeout time.Duration
+}
+
+// ConfigFromEnv reads UPLOAD_BACKEND (gcs, local, s3 or azure, default gcs) and the matching
+// GCS_* / LOCAL_STORAGE_* / S3_* / AZURE_* settings; S3 credentials fall back to AWS_*.
+// PRIVATE_RESULTS keeps objects private (no public ACLs, signed GETs on local /files) so results
+// are only readable through signed URLs. LOCAL_STORAGE_SIGNING_KEY must match between the API,
+// which signs URLs, and the worker, which verifies them. STORAGE_HTTP_TIMEOUT_SECONDS (default
+// 120) bounds each S3 or Azure request.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:          os.Getenv("UPLOAD_BACKEND"),
+		Private:          envBool("PRIVATE_RESULTS", false),
+		GCSBucket:        os.Getenv("GCS_BUCKET"),
+		GCSPublic:        envBool("GCS_PUBLIC", true),
+		GCSSkipACLErrors: envBool("GCS_PUBLIC_SKIP_ACL_ERRORS", false),
+		LocalDir:         os.Getenv("LOCAL_STORAGE_DIR"),
+		LocalBaseURL:     os.Getenv("LOCAL_STORAGE_BASE_URL"),
+		LocalSigningKey:  os.Getenv("LOCAL_STORAGE_SIGNING_KEY"),
+		S3Bucket:         os.Getenv("S3_BUCKET"),
+		S3Region:         envFirst("S3_REGION", "AWS_REGION"),
+		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
+		S3PathStyle:      envBool("S3_PATH_STYLE", false),
+		S3PublicBaseURL:  os.Getenv("S3_PUBLIC_BASE_URL"),
+		S3Credentials: s3.Credentials{
+			AccessKeyID:     envFirst("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: envFirst("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    envFirst("S3_SESSION_TOKEN", "AWS_SESSION_TOKEN"),
+		},
+		AzureAccount:   os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		AzureContainer: os.Getenv("AZURE_STORAGE_CONTAINER"),
+		AzureEndpoint:  os.Getenv("AZURE_BLOB_ENDPOINT"),
+		AzurePublic:    envBool("AZURE_PUBLIC", true),
+		AzureURLExpiry: time.Duration(envInt("AZURE_SAS_URL_TTL_SECONDS", 7*24*60*60)) * time.Second,
+		AzureCredentials: azblob.Credentials{
+			AccountKey: os.Getenv("AZURE_STORAGE_KEY"),
+			SASToken:   os.Getenv("AZURE_STORAGE_SAS_TOKEN"),
+		},
+		HTTPTimeout: time.Duration(envInt("STORAGE_HTTP_TIMEOUT_SECONDS", 120)) * time.Second,
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "gcs"
+	}
+	if cfg.LocalDir == "" {
+		cfg.LocalDir = "/tmp/image-api"
+	}
+	if cfg.LocalBaseURL == "" {
+		cfg.LocalBaseURL = "http://localhost:8001/files"
+	}
+	return cfg
+}
+
+// New builds the configured uploader; the returned close func releases backend clients.
+func New(ctx context.Context, cfg Config) (uploader.Uploader, func() error, error) {
+	switch cfg.Backend {
+	case "local":
+		local := localstore.NewUploader(cfg.LocalDir, cfg.LocalBaseURL)
+		local.SigningKey = []byte(cfg.LocalSigningKey)
+		local.Private = cfg.Private
+		if cfg.Private && len(local.SigningKey) == 0 {
+			return nil, nil, fmt.Errorf("%w: set LOCAL_STORAGE_SIGNING_KEY for PRIVATE_RESULTS", uploader.ErrSigningNotConfigured)
+		}
+		return local, func() error { return nil }, nil
+	case "gcs":
+		if cfg.GCSBucket == "" {
+			return nil, nil, fmt.Errorf("%w: set GCS_BUCKET", gcs.ErrBucketRequired)
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create storage client: %w", err)
+		}
+		store := gcs.NewUploader(client, cfg.GCSBucket, cfg.GCSPublic && !cfg.Private, cfg.GCSSkipACLErrors)
+		store.Private = cfg.Private
+		return store, client.Close, nil
+	case "s3":
+		if cfg.S3Bucket == "" {
+			return nil, nil, fmt.Errorf("%w: set S3_BUCKET", s3.ErrBucketRequired)
+		}
+		store := s3.NewUploader(httpClient(cfg), cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3Credentials, cfg.S3PathStyle)
+		store.PublicBaseURL = cfg.S3PublicBaseURL
+		return store, func() error { return nil }, nil
+	case "azure":
+		if cfg.AzureAccount == "" {
+			return nil, nil, errors.New("azure backend requires AZURE_STORAGE_ACCOUNT")
+		}
+		if cfg.AzureContainer == "" {
+			return nil, nil, fmt.Errorf("%w: set AZURE_STORAGE_CONTAINER", azblob.ErrContainerRequired)
+		}
+		if !cfg.AzurePublic && !cfg.Private {
+			// A private container only yields expiring SAS URLs, which must be signed when
+			// results are read rather than stored in them.
+			return nil, nil, fmt.Errorf("%w: set PRIVATE_RESULTS=true with AZURE_PUBLIC=false", ErrPrivateResultsRequired)
+		}
+		store, err := azblob.NewUploader(httpClient(cfg), cfg.AzureEndpoint, cfg.AzureAccount, cfg.AzureContainer, cfg.AzureCredentials, cfg.AzurePublic && !cfg.Private)
+		if err != nil {
+			return nil, nil, fmt.Errorf("azure backend: %w", err)
+		}
+		store.URLExpiry = cfg.AzureURLExpiry
+		return store, func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownBackend, cfg.Backend)
+	}
+}
+
+func httpClient(cfg Config) *http.Client {
+	// A stalled storage endpoint must not hang the request or job that uploads.
+	timeout := cfg.HTTPTimeout
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+func envBool(key string, fallback bool) bool {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.ParseBool(raw); err == nil {
+			return v
+		}
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			return v
+		}
+	}
+	return fallback
+}
+
+func envFirst(keys ...string) string {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+// Package backoff holds the retry schedule shared by the outboxes that retry failed
+// deliveries and deletions.
+package backoff
+
+import "time"
+
+// Delay returns the delay before retry number attempt (1-based): 5s doubling up to 1h.
+func Delay(attempt int) time.Duration {
+	delay := 5 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
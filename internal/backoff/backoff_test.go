@@ -0,0 +1,15 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	if Delay(1) != 5*time.Second || Delay(3) != 20*time.Second {
+		t.Fatalf("unexpected backoff progression: %v, %v", Delay(1), Delay(3))
+	}
+	if Delay(50) != time.Hour {
+		t.Fatalf("expected backoff to cap at 1h, got %v", Delay(50))
+	}
+}
@@ -0,0 +1,152 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+var (
+	ErrClosed      = errors.New("broker is closed")
+	ErrUnknownMode = errors.New("unknown broker mode")
+)
+
+// Message is one delivery of a published payload.
+type Message struct {
+	ID   string
+	Data []byte
+}
+
+// Publisher sends job messages to the configured topic.
+type Publisher interface {
+	// Publish returns once the broker has accepted data.
+	Publish(ctx context.Context, data []byte) error
+	// Ready reports whether the broker is reachable, for readiness probes.
+	Ready(ctx context.Context) error
+	Close() error
+}
+
+// Handler processes one message; returning nil acks it and an error nacks it for redelivery.
+type Handler func(ctx context.Context, msg Message) error
+
+// Subscriber hands messages to handler until ctx is done, returning nil in that case.
+type Subscriber interface {
+	Receive(ctx context.Context, handler Handler) error
+}
+
+// FlowControl bounds the work a Subscriber takes on at once.
+type FlowControl struct {
+	// MaxOutstandingMessages caps unacked messages, i.e. messages handled in parallel.
+	MaxOutstandingMessages int
+	// MaxExtension is how long ack deadlines keep being extended while a message is handled;
+	// after that Pub/Sub may redeliver it.
+	MaxExtension time.Duration
+}
+
+// Config selects the broker behind Publisher.
+type Config struct {
+	Mode      string
+	ProjectID string
+	Topic     string
+	// PushSubscription and PushEndpoint are only used in emulator mode, where the
+	// subscription is created if missing.
+	PushSubscription string
+	PushEndpoint     string
+}
+
+// ConfigFromEnv reads PUBSUB_MODE (cloud, emulator or memory, default cloud), GCP_PROJECT_ID
+// and PUBSUB_TOPIC. Memory mode keeps messages in the process, so only subscribers in the same
+// process see them; it suits tests and single-node setups whose workers poll MySQL.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Mode:      os.Getenv("PUBSUB_MODE"),
+		ProjectID: os.Getenv("GCP_PROJECT_ID"),
+		Topic:     os.Getenv("PUBSUB_TOPIC"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = "cloud"
+	}
+	return cfg
+}
+
+// NewPublisher builds the configured publisher; Close releases its clients.
+func NewPublisher(ctx context.Context, cfg Config) (Publisher, error) {
+	switch cfg.Mode {
+	case "memory":
+		return NewMemory(), nil
+	case "cloud", "emulator":
+		if cfg.ProjectID == "" {
+			return nil, errors.New("pubsub broker requires GCP_PROJECT_ID")
+		}
+		if cfg.Topic == "" {
+			return nil, errors.New("pubsub broker requires PUBSUB_TOPIC")
+		}
+		client, err := pubsub.NewClient(ctx, cfg.ProjectID)
+		if err != nil {
+			return nil, fmt.Errorf("create pubsub client: %w", err)
+		}
+		if cfg.Mode == "emulator" {
+			if err := ensureTopicWithRetry(ctx, client, cfg.Topic, 10, 500*time.Millisecond); err != nil {
+				_ = client.Close()
+				return nil, fmt.Errorf("ensure pubsub topic: %w", err)
+			}
+			if cfg.PushEndpoint != "" {
+				if err := ensureSubscription(ctx, client, cfg.Topic, cfg.PushSubscription, cfg.PushEndpoint); err != nil {
+					_ = client.Close()
+					return nil, fmt.Errorf("ensure pubsub subscription: %w", err)
+				}
+			}
+		}
+		publisher := NewPubSubPublisher(client.Topic(cfg.Topic))
+		publisher.closeClient = client.Close
+		return publisher, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMode, cfg.Mode)
+	}
+}
+
+// NewSubscriber receives from a Pub/Sub pull subscription; the returned close func releases the
+// client. In emulator mode the topic and subscription are created if missing. Memory mode is
+// rejected because its messages never leave the publishing process.
+func NewSubscriber(ctx context.Context, cfg Config, subscription string, flow FlowControl) (Subscriber, func() error, error) {
+	switch cfg.Mode {
+	case "cloud", "emulator":
+	case "memory":
+		return nil, nil, fmt.Errorf("%w: memory messages cannot be received from another process", ErrUnknownMode)
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownMode, cfg.Mode)
+	}
+	if cfg.ProjectID == "" {
+		return nil, nil, errors.New("pubsub broker requires GCP_PROJECT_ID")
+	}
+	if subscription == "" {
+		return nil, nil, errors.New("pubsub subscriber requires PUBSUB_SUBSCRIPTION")
+	}
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create pubsub client: %w", err)
+	}
+	if cfg.Mode == "emulator" {
+		if cfg.Topic == "" {
+			_ = client.Close()
+			return nil, nil, errors.New("pubsub emulator requires PUBSUB_TOPIC")
+		}
+		if err := ensureTopicWithRetry(ctx, client, cfg.Topic, 10, 500*time.Millisecond); err != nil {
+			_ = client.Close()
+			return nil, nil, fmt.Errorf("ensure pubsub topic: %w", err)
+		}
+		if err := ensureSubscription(ctx, client, cfg.Topic, subscription, ""); err != nil {
+			_ = client.Close()
+			return nil, nil, fmt.Errorf("ensure pubsub subscription: %w", err)
+		}
+	}
+
+	sub := client.Subscription(subscription)
+	sub.ReceiveSettings.MaxOutstandingMessages = flow.MaxOutstandingMessages
+	sub.ReceiveSettings.MaxExtension = flow.MaxExtension
+	return NewPubSubSubscriber(sub), client.Close, nil
+}
@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestMemoryDeliversToSubscriptions(t *testing.T) {
+	m := NewMemory()
+	if err := m.Publish(context.Background(), []byte("dropped")); err != nil {
+		t.Fatalf("publish without subscription: %v", err)
+	}
+	sub := m.Subscribe()
+	if err := m.Publish(context.Background(), []byte(`{"jobId":"a"}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got []string
+	err := sub.Receive(ctx, func(ctx context.Context, msg Message) error {
+		got = append(got, string(msg.Data))
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if len(got) != 1 || got[0] != `{"jobId":"a"}` {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+}
+
+func TestMemoryRedeliversNackedMessages(t *testing.T) {
+	m := NewMemory()
+	sub := m.Subscribe()
+	if err := m.Publish(context.Background(), []byte("job")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	deliveries := 0
+	err := sub.Receive(ctx, func(ctx context.Context, msg Message) error {
+		deliveries++
+		if deliveries == 1 {
+			return errors.New("not yet")
+		}
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if deliveries != 2 {
+		t.Fatalf("expected a redelivery, got %d deliveries", deliveries)
+	}
+}
+
+func TestMemoryClose(t *testing.T) {
+	m := NewMemory()
+	sub := m.Subscribe()
+	_ = m.Close()
+	if err := m.Publish(context.Background(), []byte("job")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from publish, got %v", err)
+	}
+	if err := sub.Receive(context.Background(), func(context.Context, Message) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from receive, got %v", err)
+	}
+}
+
+func TestNewPublisherRejectsUnknownMode(t *testing.T) {
+	if _, err := NewPublisher(context.Background(), Config{Mode: "kafka"}); !errors.Is(err, ErrUnknownMode) {
+		t.Fatalf("expected ErrUnknownMode, got %v", err)
+	}
+}
+
+func newFakePubSub(t *testing.T) (*pstest.Server, *pubsub.Client) {
+	t.Helper()
+	srv := pstest.NewServer()
+	t.Cleanup(func() { _ = srv.Close() })
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial fake pubsub: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client, err := pubsub.NewClient(context.Background(), "test-project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("pubsub client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
+
+func TestPubSubNackedMessageIsRedeliveredThenAcked(t *testing.T) {
+	srv, client := newFakePubSub(t)
+	ctx := context.Background()
+	topic, err := client.CreateTopic(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("create topic: %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "jobs-pull", pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	sub.ReceiveSettings.MaxOutstandingMessages = 1
+
+	publisher := NewPubSubPublisher(topic)
+	defer publisher.Close()
+	if err := publisher.Publish(ctx, []byte(`{"jobId":"a"}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	receiveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var (
+		mu         sync.Mutex
+		deliveries int
+	)
+	err = NewPubSubSubscriber(sub).Receive(receiveCtx, func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries++
+		if string(msg.Data) != `{"jobId":"a"}` {
+			t.Errorf("unexpected data %q", msg.Data)
+		}
+		if deliveries == 1 {
+			return errors.New("job outcome not stored")
+		}
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 || msgs[0].Deliveries < 2 || msgs[0].Acks != 1 {
+		t.Fatalf("expected a nack, a redelivery and one ack, got %+v", msgs)
+	}
+}
@@ -0,0 +1,147 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// nackDelay keeps a handler that keeps failing from spinning on the same message.
+const nackDelay = 100 * time.Millisecond
+
+var (
+	_ Publisher  = (*Memory)(nil)
+	_ Subscriber = (*MemorySubscription)(nil)
+)
+
+// Memory is an in-process broker. Each message is copied to every subscription that exists
+// when it is published and dropped when there is none, like a Pub/Sub topic without subscriptions.
+type Memory struct {
+	mu     sync.Mutex
+	subs   []*MemorySubscription
+	nextID int64
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.nextID++
+	msg := Message{ID: strconv.FormatInt(m.nextID, 10), Data: bytes.Clone(data)}
+	for _, sub := range m.subs {
+		sub.push(msg)
+	}
+	return nil
+}
+
+func (m *Memory) Ready(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close stops publishing and makes every subscription's Receive return ErrClosed.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	for _, sub := range m.subs {
+		sub.close()
+	}
+	return nil
+}
+
+// Subscribe returns a subscription that receives every message published after this call.
+func (m *Memory) Subscribe() *MemorySubscription {
+	sub := &MemorySubscription{wake: make(chan struct{}, 1)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		sub.closed = true
+	}
+	m.subs = append(m.subs, sub)
+	return sub
+}
+
+// MemorySubscription queues messages for one consumer of a Memory broker.
+type MemorySubscription struct {
+	mu     sync.Mutex
+	queue  []Message
+	closed bool
+	wake   chan struct{}
+}
+
+// Receive hands messages to handler one at a time; nacked messages are queued again
+// after a short delay.
+func (s *MemorySubscription) Receive(ctx context.Context, handler Handler) error {
+	for {
+		msg, ok, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-s.wake:
+			}
+			continue
+		}
+		if err := handler(ctx, msg); err != nil {
+			time.AfterFunc(nackDelay, func() { s.push(msg) })
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (s *MemorySubscription) push(msg Message) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *MemorySubscription) pop() (Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Message{}, false, ErrClosed
+	}
+	if len(s.queue) == 0 {
+		return Message{}, false, nil
+	}
+	msg := s.queue[0]
+	s.queue = s.queue[1:]
+	return msg, true, nil
+}
+
+func (s *MemorySubscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *MemorySubscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
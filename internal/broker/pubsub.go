@@ -0,0 +1,119 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	_ Publisher  = (*PubSubPublisher)(nil)
+	_ Subscriber = (*PubSubSubscriber)(nil)
+)
+
+// PubSubPublisher publishes to a Google Pub/Sub topic.
+type PubSubPublisher struct {
+	topic       *pubsub.Topic
+	closeClient func() error
+}
+
+func NewPubSubPublisher(topic *pubsub.Topic) *PubSubPublisher {
+	return &PubSubPublisher{topic: topic}
+}
+
+func (p *PubSubPublisher) Publish(ctx context.Context, data []byte) error {
+	// Wait for the server to acknowledge the publish.
+	result := p.topic.Publish(ctx, &pubsub.Message{Data: data})
+	_, err := result.Get(ctx)
+	return err
+}
+
+func (p *PubSubPublisher) Ready(ctx context.Context) error {
+	_, err := p.topic.Exists(ctx)
+	return err
+}
+
+func (p *PubSubPublisher) Close() error {
+	// Flush pending publishes, then close the client when this publisher created it.
+	p.topic.Stop()
+	if p.closeClient != nil {
+		return p.closeClient()
+	}
+	return nil
+}
+
+// PubSubSubscriber receives from a Google Pub/Sub subscription; flow control comes from the
+// subscription's ReceiveSettings.
+type PubSubSubscriber struct {
+	sub *pubsub.Subscription
+}
+
+func NewPubSubSubscriber(sub *pubsub.Subscription) *PubSubSubscriber {
+	return &PubSubSubscriber{sub: sub}
+}
+
+func (s *PubSubSubscriber) Receive(ctx context.Context, handler Handler) error {
+	return s.sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		if err := handler(ctx, Message{ID: m.ID, Data: m.Data}); err != nil {
+			m.Nack()
+			return
+		}
+		m.Ack()
+	})
+}
+
+func ensureTopic(ctx context.Context, client *pubsub.Client, topicName string) error {
+	// Used only for Pub/Sub emulator startup in local/dev.
+	topic := client.Topic(topicName)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err = client.CreateTopic(ctx, topicName)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func ensureTopicWithRetry(ctx context.Context, client *pubsub.Client, topicName string, attempts int, delay time.Duration) error {
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if err := ensureTopic(ctx, client, topicName); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+		time.Sleep(delay)
+	}
+	return lastErr
+}
+
+func ensureSubscription(ctx context.Context, client *pubsub.Client, topicName, subName, pushEndpoint string) error {
+	// Used only for Pub/Sub emulator startup in local/dev; an empty endpoint makes a pull subscription.
+	sub := client.Subscription(subName)
+	exists, err := sub.Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
+		Topic: client.Topic(topicName),
+		PushConfig: pubsub.PushConfig{
+			Endpoint: pushEndpoint,
+		},
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
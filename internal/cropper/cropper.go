@@ -0,0 +1,331 @@
+package cropper
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"image-api/internal/api"
+	"image-api/internal/imageproc"
+	"image-api/internal/netfetch"
+	"image-api/internal/uploader"
+)
+
+var ErrJobCancelled = errors.New("job was cancelled")
+
+// CancelledFunc reports whether jobID was cancelled after processing started.
+type CancelledFunc func(ctx context.Context, jobID string) (bool, error)
+
+// Crop is one encoded output image.
+type Crop struct {
+	Data   []byte
+	Format imageproc.Format
+}
+
+// Processor runs the download/decode/crop/resize/encode pipeline shared by the
+// worker's queued jobs and the API's synchronous crop endpoint.
+type Processor struct {
+	httpClient  *http.Client
+	uploader    uploader.Uploader
+	limits      imageproc.Limits
+	jpegQuality int
+	hosts       netfetch.HostPolicy
+	cancelled   CancelledFunc
+
+	// ContentAddressed names job outputs by the SHA-256 of their bytes instead of by job, so
+	// identical crops from repeated jobs share one object and are only uploaded once.
+	ContentAddressed bool
+	// RecordObject, when set, is called before a content-addressed object is reused or
+	// uploaded, so the job's reference keeps the shared object alive until the job is deleted.
+	RecordObject func(ctx context.Context, jobID, objectName string) error
+}
+
+// NewProcessor builds a Processor; uploader may be nil when only Render is used,
+// and cancelled may be nil when jobs cannot be cancelled.
+func NewProcessor(client *http.Client, uploader uploader.Uploader, limits imageproc.Limits, quality int, hosts netfetch.HostPolicy, cancelled CancelledFunc) *Processor {
+	return &Processor{
+		httpClient:  client,
+		uploader:    uploader,
+		limits:      limits,
+		jpegQuality: quality,
+		hosts:       hosts,
+		cancelled:   cancelled,
+	}
+}
+
+func (p *Processor) checkCancelled(ctx context.Context, jobID string) error {
+	// Stop between steps when the job was cancelled after it started.
+	if p.cancelled == nil || jobID == "" {
+		return nil
+	}
+	cancelled, err := p.cancelled(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		return ErrJobCancelled
+	}
+	return nil
+}
+
+// Process runs a queued job payload, uploading each crop to crops/{jobID}/{image}_{crop}.{ext}
+// (or objects/{sha256[:2]}/{sha256[2:]}.{ext} when ContentAddressed) and returning the job
+// result JSON. The result lists object names next to the URLs so the API can mint signed URLs
+// for private buckets.
+func (p *Processor) Process(ctx context.Context, jobID string, payload json.RawMessage) (json.RawMessage, error) {
+	var req api.ImageCropRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Images) == 0 {
+		return nil, errors.New("at least one image is required")
+	}
+
+	var urls, objects []string
+	for imageIdx, item := range req.Images {
+		if err := p.checkCancelled(ctx, jobID); err != nil {
+			return nil, err
+		}
+		imageURL := ""
+		if item.ImageUrl != nil {
+			imageURL = *item.ImageUrl
+		}
+		data, err := p.loadSource(ctx, imageURL, item.SourceObject)
+		if err != nil {
+			return nil, err
+		}
+		err = p.renderImage(ctx, jobID, data, item.CropAreas, func(cropIdx int, crop Crop) error {
+			var (
+				objectName string
+				publicURL  string
+				err        error
+			)
+			if p.ContentAddressed {
+				objectName = ContentObjectName(crop)
+				if p.RecordObject != nil {
+					if err := p.RecordObject(ctx, jobID, objectName); err != nil {
+						return err
+					}
+				}
+				publicURL, err = p.uploadOnce(ctx, objectName, crop)
+			} else {
+				objectName = fmt.Sprintf("crops/%s/%d_%d.%s", jobID, imageIdx, cropIdx, crop.Format.Extension())
+				publicURL, err = p.Upload(ctx, objectName, crop)
+			}
+			if err != nil {
+				return err
+			}
+			urls = append(urls, publicURL)
+			objects = append(objects, objectName)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, errors.New("no cropped images generated")
+	}
+
+	return json.Marshal(map[string]any{
+		"croppedImageUrls": urls,
+		"croppedObjects":   objects,
+	})
+}
+
+// Render crops one source image and returns the encoded crops in area order without uploading.
+func (p *Processor) Render(ctx context.Context, imageURL string, areas []api.CropArea) ([]Crop, error) {
+	data, err := p.loadSource(ctx, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var crops []Crop
+	err = p.renderImage(ctx, "", data, areas, func(_ int, crop Crop) error {
+		crops = append(crops, crop)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crops, nil
+}
+
+// Upload stores crop under objectName with its format's content type.
+func (p *Processor) Upload(ctx context.Context, objectName string, crop Crop) (string, error) {
+	if p.uploader == nil {
+		return "", errors.New("uploader is not configured")
+	}
+	return p.uploader.Upload(ctx, objectName, crop.Data, crop.Format.ContentType())
+}
+
+// ContentObjectName names crop by the SHA-256 of its encoded bytes, fanned out over
+// 256 prefixes: objects/ab/cdef....ext.
+func ContentObjectName(crop Crop) string {
+	sum := sha256.Sum256(crop.Data)
+	digest := hex.EncodeToString(sum[:])
+	return fmt.Sprintf("objects/%s/%s.%s", digest[:2], digest[2:], crop.Format.Extension())
+}
+
+func (p *Processor) uploadOnce(ctx context.Context, objectName string, crop Crop) (string, error) {
+	// Reuse an object that already holds these bytes; size and MD5 (when reported) guard
+	// against a truncated or foreign object under the same name.
+	if p.uploader == nil {
+		return "", errors.New("uploader is not configured")
+	}
+	info, err := p.uploader.Stat(ctx, objectName)
+	if err != nil && !errors.Is(err, uploader.ErrNotFound) {
+		return "", err
+	}
+	if err == nil && info.Size == int64(len(crop.Data)) && (info.Checksum == "" || info.Checksum == md5Hex(crop.Data)) {
+		return p.uploader.URL(ctx, objectName)
+	}
+	return p.Upload(ctx, objectName, crop)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Processor) loadSource(ctx context.Context, imageURL string, sourceObject *string) ([]byte, error) {
+	// Uploaded sources are read back from storage; everything else is fetched over HTTP.
+	if sourceObject != nil && *sourceObject != "" {
+		if p.uploader == nil {
+			return nil, errors.New("uploader is not configured")
+		}
+		reader, err := p.uploader.Open(ctx, *sourceObject)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(io.LimitReader(reader, p.limits.MaxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > p.limits.MaxBytes {
+			return nil, imageproc.ErrImageTooLarge
+		}
+		return data, nil
+	}
+
+	if imageURL == "" {
+		return nil, errors.New("imageUrl is required")
+	}
+	data, _, err := netfetch.Download(ctx, p.httpClient, imageURL, netfetch.Options{
+		MaxBytes: p.limits.MaxBytes,
+		Hosts:    p.hosts,
+	})
+	return data, err
+}
+
+func (p *Processor) renderImage(ctx context.Context, jobID string, data []byte, areas []api.CropArea, emit func(cropIdx int, crop Crop) error) error {
+	// Decode once, then hand each encoded crop to emit so callers can upload or
+	// collect them without holding every crop of a large job in memory.
+	if len(areas) == 0 {
+		return errors.New("cropAreas is required")
+	}
+
+	if _, err := imageproc.InspectImage(data, p.limits.MaxPixels); err != nil {
+		return err
+	}
+
+	metadata := imageproc.ExtractMetadata(data)
+	img, err := imageproc.DecodeImage(data)
+	if err != nil {
+		return err
+	}
+	if err := imageproc.ValidateImage(img, p.limits.MaxPixels); err != nil {
+		return err
+	}
+
+	for cropIdx, area := range areas {
+		if cropIdx > 0 {
+			if err := p.checkCancelled(ctx, jobID); err != nil {
+				return err
+			}
+		}
+		cropped, err := imageproc.CropImage(img, imageproc.Crop{
+			X:      area.X,
+			Y:      area.Y,
+			Width:  area.Width,
+			Height: area.Height,
+		})
+		if err != nil {
+			return err
+		}
+
+		if area.Resize != nil {
+			resize := resizeFromAPI(*area.Resize)
+			if err := imageproc.ValidateResize(resize, cropped.Bounds().Dx(), cropped.Bounds().Dy(), p.limits.MaxPixels); err != nil {
+				return err
+			}
+			cropped, err = imageproc.ResizeImage(cropped, resize)
+			if err != nil {
+				return err
+			}
+		}
+
+		encodeOpts, err := p.encodeOptions(area.Output, metadata)
+		if err != nil {
+			return err
+		}
+		encoded, err := imageproc.Encode(cropped, encodeOpts)
+		if err != nil {
+			return err
+		}
+		if err := emit(cropIdx, Crop{Data: encoded, Format: encodeOpts.Format}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) encodeOptions(output *api.Output, metadata imageproc.Metadata) (imageproc.EncodeOptions, error) {
+	// Fall back to a metadata-free JPEG at the configured quality when no output is requested.
+	opts := imageproc.EncodeOptions{Format: imageproc.FormatJPEG, JPEGQuality: p.jpegQuality}
+	if output == nil {
+		return opts, nil
+	}
+	if output.Format != nil {
+		opts.Format = imageproc.Format(*output.Format)
+	}
+	if output.Quality != nil {
+		opts.JPEGQuality = *output.Quality
+	}
+	if output.PngCompression != nil {
+		opts.PNGCompression = string(*output.PngCompression)
+	}
+	if output.Metadata != nil {
+		kept, err := metadata.ForMode(imageproc.MetadataMode(*output.Metadata))
+		if err != nil {
+			return imageproc.EncodeOptions{}, err
+		}
+		opts.Metadata = kept
+	}
+	return opts, nil
+}
+
+func resizeFromAPI(r api.Resize) imageproc.Resize {
+	// Translate the optional API fields into imageproc defaults (zero values).
+	var resize imageproc.Resize
+	if r.Width != nil {
+		resize.Width = *r.Width
+	}
+	if r.Height != nil {
+		resize.Height = *r.Height
+	}
+	if r.Fit != nil {
+		resize.Fit = imageproc.Fit(*r.Fit)
+	}
+	if r.Filter != nil {
+		resize.Filter = string(*r.Filter)
+	}
+	return resize
+}
@@ -0,0 +1,204 @@
+package cropper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"image-api/internal/api"
+	"image-api/internal/imageproc"
+	"image-api/internal/netfetch"
+	"image-api/internal/uploader"
+)
+
+type memoryUploader struct {
+	objects map[string]string
+	data    map[string][]byte
+	uploads int
+}
+
+func (u *memoryUploader) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
+	u.objects[objectName] = contentType
+	u.data[objectName] = data
+	u.uploads++
+	return "mem://" + objectName, nil
+}
+
+func (u *memoryUploader) URL(ctx context.Context, objectName string) (string, error) {
+	return "mem://" + objectName, nil
+}
+
+func (u *memoryUploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	data, ok := u.data[objectName]
+	if !ok {
+		return nil, uploader.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (u *memoryUploader) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	data, ok := u.data[objectName]
+	if !ok {
+		return uploader.ObjectInfo{}, uploader.ErrNotFound
+	}
+	return uploader.ObjectInfo{Size: int64(len(data)), ContentType: u.objects[objectName]}, nil
+}
+
+func (u *memoryUploader) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for name := range u.data {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (u *memoryUploader) Delete(ctx context.Context, objectName string) error {
+	delete(u.objects, objectName)
+	delete(u.data, objectName)
+	return nil
+}
+
+func encodeSource(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatalf("encode source: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newSourceServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	source := encodeSource(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(source)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRenderReturnsEncodedCrops(t *testing.T) {
+	server := newSourceServer(t)
+	p := NewProcessor(server.Client(), nil, imageproc.Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}, 90, netfetch.HostPolicy{}, nil)
+
+	pngFormat := api.Png
+	crops, err := p.Render(context.Background(), server.URL+"/a.png", []api.CropArea{
+		{X: 0, Y: 0, Width: 10, Height: 10},
+		{X: 5, Y: 5, Width: 20, Height: 10, Output: &api.Output{Format: &pngFormat}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(crops) != 2 || crops[0].Format != imageproc.FormatJPEG || crops[1].Format != imageproc.FormatPNG {
+		t.Fatalf("unexpected crops: %+v", crops)
+	}
+	cfg, err := png.Decode(bytes.NewReader(crops[1].Data))
+	if err != nil || cfg.Bounds().Dx() != 20 || cfg.Bounds().Dy() != 10 {
+		t.Fatalf("unexpected png crop: %v", err)
+	}
+}
+
+func TestProcessUploadsPerJob(t *testing.T) {
+	server := newSourceServer(t)
+	up := &memoryUploader{objects: map[string]string{}, data: map[string][]byte{}}
+	cancelled := func(ctx context.Context, jobID string) (bool, error) { return false, nil }
+	p := NewProcessor(server.Client(), up, imageproc.Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}, 90, netfetch.HostPolicy{}, cancelled)
+
+	payload, _ := json.Marshal(map[string]any{
+		"images": []map[string]any{{
+			"imageUrl":  server.URL + "/a.png",
+			"cropAreas": []map[string]int{{"x": 0, "y": 0, "width": 10, "height": 10}},
+		}},
+	})
+	result, err := p.Process(context.Background(), "job-1", payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.objects["crops/job-1/0_0.jpg"] != "image/jpeg" {
+		t.Fatalf("unexpected uploads: %v", up.objects)
+	}
+	if !bytes.Contains(result, []byte("mem://crops/job-1/0_0.jpg")) || !bytes.Contains(result, []byte(`"croppedObjects":["crops/job-1/0_0.jpg"]`)) {
+		t.Fatalf("unexpected result: %s", result)
+	}
+}
+
+func TestProcessContentAddressedUploadsOnce(t *testing.T) {
+	server := newSourceServer(t)
+	up := &memoryUploader{objects: map[string]string{}, data: map[string][]byte{}}
+	p := NewProcessor(server.Client(), up, imageproc.Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}, 90, netfetch.HostPolicy{}, nil)
+	p.ContentAddressed = true
+	var recorded []string
+	p.RecordObject = func(ctx context.Context, jobID, objectName string) error {
+		recorded = append(recorded, jobID+":"+objectName)
+		return nil
+	}
+
+	payload, _ := json.Marshal(map[string]any{
+		"images": []map[string]any{{
+			"imageUrl":  server.URL + "/a.png",
+			"cropAreas": []map[string]int{{"x": 0, "y": 0, "width": 10, "height": 10}},
+		}},
+	})
+	first, err := p.Process(context.Background(), "job-1", payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := p.Process(context.Background(), "job-2", payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.uploads != 1 || len(up.objects) != 1 {
+		t.Fatalf("expected one shared upload, got %d: %v", up.uploads, up.objects)
+	}
+	for name := range up.objects {
+		if !strings.HasPrefix(name, "objects/") || !strings.HasSuffix(name, ".jpg") || !bytes.Contains(second, []byte("mem://"+name)) {
+			t.Fatalf("unexpected object %q in %s", name, second)
+		}
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatalf("expected identical results, got %s and %s", first, second)
+	}
+	if len(recorded) != 2 || !strings.HasPrefix(recorded[0], "job-1:objects/") || !strings.HasPrefix(recorded[1], "job-2:objects/") {
+		t.Fatalf("expected both jobs to record their reference, got %v", recorded)
+	}
+}
+
+func TestProcessReadsSourceObject(t *testing.T) {
+	up := &memoryUploader{objects: map[string]string{}, data: map[string][]byte{"sources/a.png": encodeSource(t)}}
+	// A client that fails every request proves the source is not fetched over HTTP.
+	client := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatalf("unexpected fetch")
+		return nil, nil
+	})}
+	p := NewProcessor(client, up, imageproc.Limits{MaxBytes: 1 << 20, MaxPixels: 10_000}, 90, netfetch.HostPolicy{}, nil)
+
+	payload, _ := json.Marshal(map[string]any{
+		"images": []map[string]any{{
+			"imageUrl":     "https://example.com/ignored.png",
+			"sourceObject": "sources/a.png",
+			"cropAreas":    []map[string]int{{"x": 0, "y": 0, "width": 10, "height": 10}},
+		}},
+	})
+	if _, err := p.Process(context.Background(), "job-2", payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := up.objects["crops/job-2/0_0.jpg"]; !ok {
+		t.Fatalf("unexpected uploads: %v", up.objects)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
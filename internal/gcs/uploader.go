@@ -2,11 +2,17 @@ package gcs
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"time"
+
+	"image-api/internal/uploader"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
 )
 
 var ErrBucketRequired = errors.New("bucket is required")
@@ -16,6 +22,9 @@ type Uploader struct {
 	Bucket                string
 	MakePublic            bool
 	AllowPublicACLFailure bool
+	// Private objects have no readable plain URL; Upload and URL return "" and readers get
+	// signed URLs instead.
+	Private bool
 }
 
 func NewUploader(client *storage.Client, bucket string, makePublic bool, allowPublicACLFailure bool) *Uploader {
@@ -29,40 +38,174 @@ func NewUploader(client *storage.Client, bucket string, makePublic bool, allowPu
 
 func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
 	// Write the object and optionally make it public, returning the public URL.
+	if err := u.UploadPrivate(ctx, objectName, data, contentType); err != nil {
+		return "", err
+	}
+
+	obj := u.Client.Bucket(u.Bucket).Object(objectName)
+	if u.MakePublic {
+		if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+			if u.AllowPublicACLFailure && strings.Contains(err.Error(), "uniform bucket-level access") {
+				return publicURL(u.Bucket, objectName), nil
+			}
+			return "", err
+		}
+	}
+
+	return u.URL(ctx, objectName)
+}
+
+// UploadPrivate writes the object without the public ACL Upload sets when MakePublic is on.
+func (u *Uploader) UploadPrivate(ctx context.Context, objectName string, data []byte, contentType string) error {
 	if u.Client == nil {
-		return "", errors.New("storage client is required")
+		return errors.New("storage client is required")
 	}
 	if u.Bucket == "" {
-		return "", ErrBucketRequired
+		return ErrBucketRequired
 	}
 	if objectName == "" {
-		return "", errors.New("object name is required")
+		return errors.New("object name is required")
 	}
 
-	obj := u.Client.Bucket(u.Bucket).Object(objectName)
-	writer := obj.NewWriter(ctx)
+	writer := u.Client.Bucket(u.Bucket).Object(objectName).NewWriter(ctx)
 	if contentType != "" {
 		writer.ContentType = contentType
 	}
-
 	if _, err := writer.Write(data); err != nil {
 		_ = writer.Close()
-		return "", err
+		return err
 	}
-	if err := writer.Close(); err != nil {
-		return "", err
+	return writer.Close()
+}
+
+func (u *Uploader) URL(ctx context.Context, objectName string) (string, error) {
+	if u.Bucket == "" {
+		return "", ErrBucketRequired
+	}
+	if u.Private {
+		return "", nil
 	}
+	return publicURL(u.Bucket, objectName), nil
+}
 
-	if u.MakePublic {
-		if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-			if u.AllowPublicACLFailure && strings.Contains(err.Error(), "uniform bucket-level access") {
-				return publicURL(u.Bucket, objectName), nil
-			}
-			return "", err
+func (u *Uploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	// Stream an object back, e.g. an uploaded source image.
+	obj, err := u.object(objectName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := obj.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (u *Uploader) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	obj, err := u.object(objectName)
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return uploader.ObjectInfo{}, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	// Composite objects have no MD5, only CRC32C.
+	return uploader.ObjectInfo{
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Checksum:    hex.EncodeToString(attrs.MD5),
+	}, nil
+}
+
+func (u *Uploader) Delete(ctx context.Context, objectName string) error {
+	obj, err := u.object(objectName)
+	if err != nil {
+		return err
+	}
+	if err := obj.Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	if u.Client == nil {
+		return nil, errors.New("storage client is required")
+	}
+	if u.Bucket == "" {
+		return nil, ErrBucketRequired
+	}
+
+	query := &storage.Query{Prefix: prefix}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+	var names []string
+	it := u.Client.Bucket(u.Bucket).Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
 		}
+		names = append(names, attrs.Name)
 	}
+}
 
-	return publicURL(u.Bucket, objectName), nil
+func (u *Uploader) object(objectName string) (*storage.ObjectHandle, error) {
+	if u.Client == nil {
+		return nil, errors.New("storage client is required")
+	}
+	if u.Bucket == "" {
+		return nil, ErrBucketRequired
+	}
+	if objectName == "" {
+		return nil, errors.New("object name is required")
+	}
+	return u.Client.Bucket(u.Bucket).Object(objectName), nil
+}
+
+func (u *Uploader) SignURL(ctx context.Context, objectName string, opts uploader.SignOptions) (uploader.SignedURL, error) {
+	// V4-sign with the client's credentials (a key file, or IAM signBlob on Cloud Run).
+	_ = ctx
+	if u.Client == nil {
+		return uploader.SignedURL{}, errors.New("storage client is required")
+	}
+	if u.Bucket == "" {
+		return uploader.SignedURL{}, ErrBucketRequired
+	}
+
+	headers := map[string]string{}
+	signOpts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  opts.Method,
+		Expires: time.Now().Add(opts.Expires),
+	}
+	if opts.ContentType != "" {
+		signOpts.ContentType = opts.ContentType
+		headers["Content-Type"] = opts.ContentType
+	}
+	if opts.MaxBytes > 0 {
+		// GCS rejects the PUT when the body falls outside the signed range.
+		lengthRange := fmt.Sprintf("0,%d", opts.MaxBytes)
+		signOpts.Headers = []string{"x-goog-content-length-range:" + lengthRange}
+		headers["x-goog-content-length-range"] = lengthRange
+	}
+
+	signed, err := u.Client.Bucket(u.Bucket).SignedURL(objectName, signOpts)
+	if err != nil {
+		return uploader.SignedURL{}, err
+	}
+	return uploader.SignedURL{URL: signed, Headers: headers}, nil
 }
 
 func publicURL(bucket, objectName string) string {
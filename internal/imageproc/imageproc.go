@@ -3,18 +3,53 @@ package imageproc
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"math"
 
+	"github.com/HugoSmits86/nativewebp"
 	"github.com/disintegration/imaging"
 )
 
 var (
 	ErrImageTooLarge      = errors.New("image exceeds maximum size")
 	ErrImageTooManyPixels = errors.New("image exceeds maximum pixel count")
+	ErrUnsupportedFormat  = errors.New("unsupported image format")
+	ErrInvalidImageHeader = errors.New("invalid image header")
 	ErrCropOutOfBounds    = errors.New("crop rectangle exceeds image bounds")
 	ErrCropInvalid        = errors.New("crop rectangle is invalid")
+	ErrResizeInvalid      = errors.New("resize dimensions are invalid")
+	ErrUnknownFit         = errors.New("unknown resize fit mode")
+	ErrUnknownFilter      = errors.New("unknown resampling filter")
+	ErrUnknownFormat      = errors.New("unknown output format")
+	ErrUnknownCompression = errors.New("unknown png compression level")
 )
 
+// Fit controls how a resized image maps onto the requested box.
+type Fit string
+
+const (
+	// FitFill stretches the image to exactly width x height, ignoring aspect ratio.
+	FitFill Fit = "fill"
+	// FitContain scales the image to fit inside the box and pads the rest with transparency.
+	FitContain Fit = "contain"
+	// FitCover scales the image to cover the box and crops the overflow around the center.
+	FitCover Fit = "cover"
+	// FitInside scales the image to fit inside the box without padding.
+	FitInside Fit = "inside"
+)
+
+var resampleFilters = map[string]imaging.ResampleFilter{
+	"nearest":    imaging.NearestNeighbor,
+	"box":        imaging.Box,
+	"linear":     imaging.Linear,
+	"mitchell":   imaging.MitchellNetravali,
+	"catmullrom": imaging.CatmullRom,
+	"lanczos":    imaging.Lanczos,
+}
+
 type Crop struct {
 	X      int
 	Y      int
@@ -22,13 +57,90 @@ type Crop struct {
 	Height int
 }
 
+// Resize describes a scale step applied after cropping.
+// A zero Width or Height preserves the aspect ratio using the other dimension.
+// An empty Fit defaults to cover and an empty Filter defaults to lanczos.
+type Resize struct {
+	Width  int
+	Height int
+	Fit    Fit
+	Filter string
+}
+
+// Format is an output encoding supported by Encode.
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+	FormatGIF  Format = "gif"
+	FormatTIFF Format = "tiff"
+)
+
+type formatInfo struct {
+	contentType string
+	extension   string
+}
+
+var formats = map[Format]formatInfo{
+	FormatJPEG: {contentType: "image/jpeg", extension: "jpg"},
+	FormatPNG:  {contentType: "image/png", extension: "png"},
+	FormatWebP: {contentType: "image/webp", extension: "webp"},
+	FormatGIF:  {contentType: "image/gif", extension: "gif"},
+	FormatTIFF: {contentType: "image/tiff", extension: "tiff"},
+}
+
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// EncodeOptions selects the output format and its format-specific settings.
+// An empty Format defaults to JPEG; WebP output is always lossless.
+// Metadata is embedded into JPEG and PNG output and dropped for other formats.
+type EncodeOptions struct {
+	Format         Format
+	JPEGQuality    int
+	PNGCompression string
+	Metadata       Metadata
+}
+
+// ImageInfo is what InspectImage learns from the image header alone.
+type ImageInfo struct {
+	Format string
+	Width  int
+	Height int
+}
+
 type Limits struct {
 	MaxBytes  int64
 	MaxPixels int
 }
 
+func InspectImage(data []byte, maxPixels int) (ImageInfo, error) {
+	// Read only the header so oversized images are rejected before a bitmap is allocated.
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return ImageInfo{}, ErrUnsupportedFormat
+		}
+		return ImageInfo{}, fmt.Errorf("%w: %v", ErrInvalidImageHeader, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return ImageInfo{}, fmt.Errorf("%w: %dx%d", ErrInvalidImageHeader, cfg.Width, cfg.Height)
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > int64(maxPixels) {
+		return ImageInfo{}, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrImageTooManyPixels, cfg.Width, cfg.Height, maxPixels)
+	}
+	return ImageInfo{Format: format, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
 func DecodeImage(data []byte) (image.Image, error) {
-	return imaging.Decode(bytes.NewReader(data))
+	// Apply EXIF orientation so crop coordinates match what viewers display.
+	return imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
 }
 
 func ValidateImage(img image.Image, maxPixels int) error {
@@ -64,6 +176,190 @@ func CropImage(img image.Image, crop Crop) (image.Image, error) {
 	return imaging.Crop(img, rect), nil
 }
 
+// MaxResizeDimension bounds a requested resize width or height.
+const MaxResizeDimension = 10000
+
+// ValidateResize checks resize for a srcW x srcH crop before any pixels are touched. The pixel
+// cap applies to the real output size, which a single dimension derives from the aspect ratio,
+// and to the intermediate bitmap cover mode scales to before cropping.
+func ValidateResize(resize Resize, srcW, srcH, maxPixels int) error {
+	if resize.Width < 0 || resize.Height < 0 || (resize.Width == 0 && resize.Height == 0) {
+		return ErrResizeInvalid
+	}
+	if resize.Width > MaxResizeDimension || resize.Height > MaxResizeDimension {
+		return ErrResizeInvalid
+	}
+	if srcW <= 0 || srcH <= 0 {
+		return ErrResizeInvalid
+	}
+	switch resize.Fit {
+	case "", FitFill, FitContain, FitCover, FitInside:
+	default:
+		return ErrUnknownFit
+	}
+	if _, err := resampleFilter(resize.Filter); err != nil {
+		return err
+	}
+	if maxPixels <= 0 {
+		return nil
+	}
+	width, height := ResizedSize(srcW, srcH, resize)
+	peak := int64(width) * int64(height)
+	if resize.Width > 0 && resize.Height > 0 && (resize.Fit == "" || resize.Fit == FitCover) {
+		coverW, coverH := coverSize(srcW, srcH, resize.Width, resize.Height)
+		peak = max(peak, int64(coverW)*int64(coverH))
+	}
+	if peak > int64(maxPixels) {
+		return ErrImageTooManyPixels
+	}
+	return nil
+}
+
+// ResizedSize returns the dimensions ResizeImage produces for a srcW x srcH image.
+func ResizedSize(srcW, srcH int, resize Resize) (int, int) {
+	switch {
+	case resize.Width == 0:
+		return scaledSide(srcW, resize.Height, srcH), resize.Height
+	case resize.Height == 0:
+		return resize.Width, scaledSide(srcH, resize.Width, srcW)
+	case resize.Fit == FitInside:
+		return insideSize(srcW, srcH, resize.Width, resize.Height)
+	default:
+		// Fill stretches, contain pads and cover crops to exactly the box.
+		return resize.Width, resize.Height
+	}
+}
+
+func ResizeImage(img image.Image, resize Resize) (image.Image, error) {
+	bounds := img.Bounds()
+	if err := ValidateResize(resize, bounds.Dx(), bounds.Dy(), 0); err != nil {
+		return nil, err
+	}
+	filter, err := resampleFilter(resize.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if resize.Width == 0 || resize.Height == 0 {
+		// A single dimension always keeps the source aspect ratio.
+		return imaging.Resize(img, resize.Width, resize.Height, filter), nil
+	}
+
+	switch resize.Fit {
+	case FitFill:
+		return imaging.Resize(img, resize.Width, resize.Height, filter), nil
+	case FitInside:
+		width, height := insideSize(bounds.Dx(), bounds.Dy(), resize.Width, resize.Height)
+		return imaging.Resize(img, width, height, filter), nil
+	case FitContain:
+		width, height := insideSize(bounds.Dx(), bounds.Dy(), resize.Width, resize.Height)
+		scaled := imaging.Resize(img, width, height, filter)
+		canvas := imaging.New(resize.Width, resize.Height, color.NRGBA{})
+		return imaging.PasteCenter(canvas, scaled), nil
+	default:
+		return imaging.Fill(img, resize.Width, resize.Height, imaging.Center, filter), nil
+	}
+}
+
+func insideSize(srcW, srcH, maxW, maxH int) (int, int) {
+	// Largest size with the source aspect ratio that fits within maxW x maxH.
+	scale := math.Min(float64(maxW)/float64(srcW), float64(maxH)/float64(srcH))
+	width := int(math.Max(1, math.Round(float64(srcW)*scale)))
+	height := int(math.Max(1, math.Round(float64(srcH)*scale)))
+	return width, height
+}
+
+func coverSize(srcW, srcH, minW, minH int) (int, int) {
+	// Smallest size with the source aspect ratio that covers minW x minH.
+	scale := math.Max(float64(minW)/float64(srcW), float64(minH)/float64(srcH))
+	width := int(math.Max(1, math.Round(float64(srcW)*scale)))
+	height := int(math.Max(1, math.Round(float64(srcH)*scale)))
+	return width, height
+}
+
+func scaledSide(side, target, targetSide int) int {
+	// Scale side by target/targetSide, as imaging.Resize does for a zero dimension.
+	return int(math.Max(1, math.Round(float64(side)*float64(target)/float64(targetSide))))
+}
+
+func resampleFilter(name string) (imaging.ResampleFilter, error) {
+	if name == "" {
+		return imaging.Lanczos, nil
+	}
+	filter, ok := resampleFilters[name]
+	if !ok {
+		return imaging.ResampleFilter{}, ErrUnknownFilter
+	}
+	return filter, nil
+}
+
+// ContentType returns the MIME type for the format, defaulting to JPEG.
+func (f Format) ContentType() string {
+	if info, ok := formats[f]; ok {
+		return info.contentType
+	}
+	return formats[FormatJPEG].contentType
+}
+
+// Extension returns the file extension (without dot) for the format, defaulting to JPEG.
+func (f Format) Extension() string {
+	if info, ok := formats[f]; ok {
+		return info.extension
+	}
+	return formats[FormatJPEG].extension
+}
+
+func ValidateEncodeOptions(opts EncodeOptions) error {
+	if opts.Format != "" {
+		if _, ok := formats[opts.Format]; !ok {
+			return ErrUnknownFormat
+		}
+	}
+	if opts.PNGCompression != "" {
+		if _, ok := pngCompressionLevels[opts.PNGCompression]; !ok {
+			return ErrUnknownCompression
+		}
+	}
+	return nil
+}
+
+func Encode(img image.Image, opts EncodeOptions) ([]byte, error) {
+	if err := ValidateEncodeOptions(opts); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case "", FormatJPEG:
+		data, err := EncodeJPEG(img, opts.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	case FormatPNG:
+		level := png.DefaultCompression
+		if opts.PNGCompression != "" {
+			level = pngCompressionLevels[opts.PNGCompression]
+		}
+		if err := imaging.Encode(&buf, img, imaging.PNG, imaging.PNGCompressionLevel(level)); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+	case FormatGIF:
+		if err := imaging.Encode(&buf, img, imaging.GIF); err != nil {
+			return nil, err
+		}
+	case FormatTIFF:
+		if err := imaging.Encode(&buf, img, imaging.TIFF); err != nil {
+			return nil, err
+		}
+	}
+	return EmbedMetadata(buf.Bytes(), opts.Format, opts.Metadata)
+}
+
 func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
 	if quality <= 0 || quality > 100 {
 		quality = 90
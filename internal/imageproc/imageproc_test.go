@@ -2,10 +2,15 @@ package imageproc
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"testing"
+
+	_ "golang.org/x/image/webp"
 )
 
 func TestValidateImageMaxPixels(t *testing.T) {
@@ -15,6 +20,27 @@ func TestValidateImageMaxPixels(t *testing.T) {
 	}
 }
 
+func TestInspectImageRejectsBeforeDecode(t *testing.T) {
+	// A bare PNG signature + IHDR declaring 60000x60000 pixels; there is no pixel data at all.
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], 60000)
+	binary.BigEndian.PutUint32(ihdr[4:8], 60000)
+	ihdr[8], ihdr[9] = 8, 6
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.WriteString("IHDR")
+	buf.Write(ihdr)
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("IHDR"), ihdr...)))
+
+	if _, err := InspectImage(buf.Bytes(), 25_000_000); !errors.Is(err, ErrImageTooManyPixels) {
+		t.Fatalf("expected ErrImageTooManyPixels, got %v", err)
+	}
+	if _, err := InspectImage([]byte("not an image"), 0); err != ErrUnsupportedFormat {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
 func TestCropImageOutOfBounds(t *testing.T) {
 	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
 	_, err := CropImage(img, Crop{X: 5, Y: 5, Width: 10, Height: 10})
@@ -42,3 +68,174 @@ func TestEncodeJPEG(t *testing.T) {
 		t.Fatalf("unexpected bounds: %v", decoded.Bounds())
 	}
 }
+
+func TestResizeImageFitModes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	cases := []struct {
+		fit    Fit
+		width  int
+		height int
+	}{
+		{FitFill, 50, 50},
+		{FitCover, 50, 50},
+		{FitContain, 50, 50},
+		{FitInside, 50, 25},
+	}
+	for _, tc := range cases {
+		resized, err := ResizeImage(img, Resize{Width: 50, Height: 50, Fit: tc.fit})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.fit, err)
+		}
+		if resized.Bounds().Dx() != tc.width || resized.Bounds().Dy() != tc.height {
+			t.Fatalf("%s: unexpected bounds: %v", tc.fit, resized.Bounds())
+		}
+	}
+}
+
+func TestValidateResize(t *testing.T) {
+	if err := ValidateResize(Resize{Width: 10, Fit: "stretch"}, 10, 10, 0); err != ErrUnknownFit {
+		t.Fatalf("expected ErrUnknownFit, got %v", err)
+	}
+	if err := ValidateResize(Resize{Width: 10, Filter: "bicubic"}, 10, 10, 0); err != ErrUnknownFilter {
+		t.Fatalf("expected ErrUnknownFilter, got %v", err)
+	}
+	if err := ValidateResize(Resize{}, 10, 10, 0); err != ErrResizeInvalid {
+		t.Fatalf("expected ErrResizeInvalid, got %v", err)
+	}
+	if err := ValidateResize(Resize{Width: MaxResizeDimension + 1}, 10, 10, 0); err != ErrResizeInvalid {
+		t.Fatalf("expected ErrResizeInvalid for oversized width, got %v", err)
+	}
+	if err := ValidateResize(Resize{Width: 100, Height: 100}, 10, 10, 50); err != ErrImageTooManyPixels {
+		t.Fatalf("expected ErrImageTooManyPixels, got %v", err)
+	}
+}
+
+func TestValidateResizeCapsDerivedSizes(t *testing.T) {
+	const maxPixels = 1_000_000
+	cases := []struct {
+		name       string
+		resize     Resize
+		srcW, srcH int
+	}{
+		// One dimension keeps the aspect ratio: 10000 x 10000.
+		{"width only", Resize{Width: 10000}, 10, 10},
+		{"height only", Resize{Height: 10000}, 10, 10},
+		// Cover scales a 1x99 crop to 1000 x 99000 before cropping to the box.
+		{"cover intermediate", Resize{Width: 1000, Height: 1000}, 1, 99},
+		{"contain canvas", Resize{Width: 2000, Height: 2000, Fit: FitContain}, 10, 10},
+	}
+	for _, tc := range cases {
+		if err := ValidateResize(tc.resize, tc.srcW, tc.srcH, maxPixels); err != ErrImageTooManyPixels {
+			t.Errorf("%s: expected ErrImageTooManyPixels, got %v", tc.name, err)
+		}
+	}
+	if err := ValidateResize(Resize{Width: 1000, Height: 1000, Fit: FitInside}, 1, 99, maxPixels); err != nil {
+		t.Errorf("inside keeps the aspect ratio within the box: %v", err)
+	}
+	if w, h := ResizedSize(200, 100, Resize{Width: 50}); w != 50 || h != 25 {
+		t.Errorf("unexpected derived size %dx%d", w, h)
+	}
+}
+
+func TestEncodeFormats(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.NRGBA{G: 255, A: 128})
+	for _, format := range []Format{FormatJPEG, FormatPNG, FormatWebP, FormatGIF, FormatTIFF} {
+		data, err := Encode(img, EncodeOptions{Format: format, PNGCompression: "best"})
+		if err != nil {
+			t.Fatalf("%s: encode failed: %v", format, err)
+		}
+		cfg, name, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode config failed: %v", format, err)
+		}
+		if name != string(format) {
+			t.Fatalf("%s: decoded as %s", format, name)
+		}
+		if cfg.Width != 4 || cfg.Height != 4 {
+			t.Fatalf("%s: unexpected size %dx%d", format, cfg.Width, cfg.Height)
+		}
+	}
+
+	if _, err := Encode(img, EncodeOptions{Format: "bmp"}); err != ErrUnknownFormat {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	// Big-endian TIFF header with a single IFD0 entry: orientation = 6 (rotate 90 CW).
+	exif := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	icc := bytes.Repeat([]byte("icc"), 100)
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+
+	for _, format := range []Format{FormatJPEG, FormatPNG} {
+		data, err := Encode(img, EncodeOptions{Format: format, Metadata: Metadata{EXIF: exif, ICC: icc}})
+		if err != nil {
+			t.Fatalf("%s: encode failed: %v", format, err)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: embedded output no longer decodes: %v", format, err)
+		}
+
+		meta := ExtractMetadata(data)
+		if !bytes.Equal(meta.ICC, icc) {
+			t.Fatalf("%s: icc profile not preserved", format)
+		}
+		if len(meta.EXIF) != len(exif) || meta.EXIF[19] != 1 {
+			t.Fatalf("%s: expected exif with orientation reset to 1, got %v", format, meta.EXIF)
+		}
+
+		stripped, err := meta.ForMode(MetadataICC)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stripped.EXIF != nil || !bytes.Equal(stripped.ICC, icc) {
+			t.Fatalf("%s: icc mode should keep only the profile", format)
+		}
+	}
+}
+
+func TestEmbedMetadataStripsEXIFThumbnail(t *testing.T) {
+	// Big-endian TIFF: IFD0 with no entries links to IFD1, whose thumbnail is 4 bytes at 44.
+	exif := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x00,
+		0x00, 0x00, 0x00, 0x0E,
+		0x00, 0x02,
+		0x02, 0x01, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x2C,
+		0x02, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xD8, 0xFF, 0xD9,
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	data, err := Encode(img, EncodeOptions{Format: FormatJPEG, Metadata: Metadata{EXIF: exif}})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	got := ExtractMetadata(data).EXIF
+	if len(got) != len(exif) {
+		t.Fatalf("unexpected exif length %d", len(got))
+	}
+	if !bytes.Equal(got[10:14], []byte{0, 0, 0, 0}) {
+		t.Fatalf("expected IFD1 to be unlinked, got %v", got[10:14])
+	}
+	if !bytes.Equal(got[14:], make([]byte, len(exif)-14)) {
+		t.Fatalf("expected IFD1 and thumbnail to be zeroed, got %v", got[14:])
+	}
+}
+
+func TestExtractMetadataDropsOversizedICC(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	data, err := Encode(img, EncodeOptions{Format: FormatPNG, Metadata: Metadata{ICC: make([]byte, maxICCBytes+1)}})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if icc := ExtractMetadata(data).ICC; icc != nil {
+		t.Fatalf("expected oversized profile to be dropped, got %d bytes", len(icc))
+	}
+}
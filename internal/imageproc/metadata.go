@@ -0,0 +1,383 @@
+package imageproc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// MetadataMode controls which source metadata is carried into encoded output.
+type MetadataMode string
+
+const (
+	// MetadataStrip drops all metadata, including EXIF GPS tags.
+	MetadataStrip MetadataMode = "strip"
+	// MetadataICC keeps only the ICC color profile.
+	MetadataICC MetadataMode = "icc"
+	// MetadataPreserve keeps EXIF, XMP and ICC metadata; the EXIF thumbnail (IFD1) is dropped.
+	MetadataPreserve MetadataMode = "preserve"
+)
+
+var ErrUnknownMetadataMode = errors.New("unknown metadata mode")
+
+// Metadata holds raw metadata blocks lifted from a source image.
+// EXIF is the TIFF-structured payload without the JPEG "Exif\0\0" prefix.
+type Metadata struct {
+	EXIF []byte
+	XMP  []byte
+	ICC  []byte
+}
+
+var (
+	jpegEXIFPrefix = []byte("Exif\x00\x00")
+	jpegXMPPrefix  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegICCPrefix  = []byte("ICC_PROFILE\x00")
+	pngSignature   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+const (
+	jpegMaxSegment  = 65533
+	pngXMPKeyword   = "XML:com.adobe.xmp"
+	exifOrientation = 0x0112
+	// maxICCBytes caps a decompressed iCCP profile; real profiles are well below 1 MiB.
+	maxICCBytes = 4 << 20
+	// exifThumbnailOffset and exifThumbnailLength locate the JPEG thumbnail IFD1 points to.
+	exifThumbnailOffset = 0x0201
+	exifThumbnailLength = 0x0202
+)
+
+// IsEmpty reports whether no metadata block is present.
+func (m Metadata) IsEmpty() bool {
+	return len(m.EXIF) == 0 && len(m.XMP) == 0 && len(m.ICC) == 0
+}
+
+// ForMode returns the subset of metadata allowed by mode.
+func (m Metadata) ForMode(mode MetadataMode) (Metadata, error) {
+	switch mode {
+	case "", MetadataStrip:
+		return Metadata{}, nil
+	case MetadataICC:
+		return Metadata{ICC: m.ICC}, nil
+	case MetadataPreserve:
+		return m, nil
+	default:
+		return Metadata{}, ErrUnknownMetadataMode
+	}
+}
+
+// ExtractMetadata reads EXIF, XMP and ICC blocks from JPEG or PNG data.
+// Other formats and malformed input yield empty metadata rather than an error.
+func ExtractMetadata(data []byte) Metadata {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return extractJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return extractPNGMetadata(data)
+	default:
+		return Metadata{}
+	}
+}
+
+func extractJPEGMetadata(data []byte) Metadata {
+	var meta Metadata
+	var iccChunks [][]byte
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image: no more header segments.
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		payload := data[pos+4 : pos+2+length]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegEXIFPrefix):
+			meta.EXIF = append([]byte(nil), payload[len(jpegEXIFPrefix):]...)
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegXMPPrefix):
+			meta.XMP = append([]byte(nil), payload[len(jpegXMPPrefix):]...)
+		case marker == 0xE2 && bytes.HasPrefix(payload, jpegICCPrefix) && len(payload) > len(jpegICCPrefix)+2:
+			// ICC profiles are split across APP2 segments with a 1-based sequence number.
+			seq := int(payload[len(jpegICCPrefix)])
+			total := int(payload[len(jpegICCPrefix)+1])
+			if seq >= 1 && seq <= total {
+				if iccChunks == nil {
+					iccChunks = make([][]byte, total)
+				}
+				if seq <= len(iccChunks) {
+					iccChunks[seq-1] = payload[len(jpegICCPrefix)+2:]
+				}
+			}
+		}
+		pos += 2 + length
+	}
+	if len(iccChunks) > 0 {
+		var icc []byte
+		for _, chunk := range iccChunks {
+			if chunk == nil {
+				icc = nil
+				break
+			}
+			icc = append(icc, chunk...)
+		}
+		meta.ICC = icc
+	}
+	return meta
+}
+
+func extractPNGMetadata(data []byte) Metadata {
+	var meta Metadata
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		payload := data[pos+8 : pos+8+length]
+		switch chunkType {
+		case "eXIf":
+			meta.EXIF = append([]byte(nil), payload...)
+		case "iCCP":
+			meta.ICC = decodePNGICC(payload)
+		case "iTXt":
+			if xmp := decodePNGXMP(payload); xmp != nil {
+				meta.XMP = xmp
+			}
+		case "IDAT", "IEND":
+			return meta
+		}
+		pos += 12 + length
+	}
+	return meta
+}
+
+func decodePNGICC(payload []byte) []byte {
+	// iCCP: profile name, NUL, compression method, zlib stream.
+	nul := bytes.IndexByte(payload, 0)
+	if nul < 0 || nul+2 > len(payload) {
+		return nil
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(payload[nul+2:]))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	// The stream is attacker-controlled, so bound it instead of inflating a zip bomb.
+	profile, err := io.ReadAll(io.LimitReader(reader, maxICCBytes+1))
+	if err != nil || len(profile) > maxICCBytes {
+		return nil
+	}
+	return profile
+}
+
+func decodePNGXMP(payload []byte) []byte {
+	// iTXt: keyword, NUL, compression flag, method, language, NUL, translated keyword, NUL, text.
+	prefix := []byte(pngXMPKeyword + "\x00\x00\x00")
+	if !bytes.HasPrefix(payload, prefix) {
+		return nil
+	}
+	rest := payload[len(prefix):]
+	for i := 0; i < 2; i++ {
+		nul := bytes.IndexByte(rest, 0)
+		if nul < 0 {
+			return nil
+		}
+		rest = rest[nul+1:]
+	}
+	return append([]byte(nil), rest...)
+}
+
+// EmbedMetadata writes meta into already-encoded JPEG or PNG data.
+// Formats without metadata support are returned unchanged.
+func EmbedMetadata(encoded []byte, format Format, meta Metadata) ([]byte, error) {
+	if meta.IsEmpty() {
+		return encoded, nil
+	}
+	if len(meta.EXIF) > 0 {
+		// Pixels are already auto-oriented, so viewers must not rotate them again.
+		meta.EXIF = stripEXIFThumbnail(resetEXIFOrientation(meta.EXIF))
+	}
+	switch format {
+	case "", FormatJPEG:
+		return embedJPEGMetadata(encoded, meta)
+	case FormatPNG:
+		return embedPNGMetadata(encoded, meta)
+	default:
+		return encoded, nil
+	}
+}
+
+func embedJPEGMetadata(encoded []byte, meta Metadata) ([]byte, error) {
+	if !bytes.HasPrefix(encoded, []byte{0xFF, 0xD8}) {
+		return nil, errors.New("invalid jpeg data")
+	}
+	var segments bytes.Buffer
+	if len(meta.EXIF) > 0 && len(jpegEXIFPrefix)+len(meta.EXIF) <= jpegMaxSegment {
+		writeJPEGSegment(&segments, 0xE1, jpegEXIFPrefix, meta.EXIF)
+	}
+	if len(meta.XMP) > 0 && len(jpegXMPPrefix)+len(meta.XMP) <= jpegMaxSegment {
+		writeJPEGSegment(&segments, 0xE1, jpegXMPPrefix, meta.XMP)
+	}
+	if len(meta.ICC) > 0 {
+		chunkSize := jpegMaxSegment - len(jpegICCPrefix) - 2
+		total := (len(meta.ICC) + chunkSize - 1) / chunkSize
+		if total <= 255 {
+			for i := 0; i < total; i++ {
+				end := (i + 1) * chunkSize
+				if end > len(meta.ICC) {
+					end = len(meta.ICC)
+				}
+				header := append(append([]byte(nil), jpegICCPrefix...), byte(i+1), byte(total))
+				writeJPEGSegment(&segments, 0xE2, header, meta.ICC[i*chunkSize:end])
+			}
+		}
+	}
+
+	out := make([]byte, 0, len(encoded)+segments.Len())
+	out = append(out, encoded[:2]...)
+	out = append(out, segments.Bytes()...)
+	out = append(out, encoded[2:]...)
+	return out, nil
+}
+
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, header, payload []byte) {
+	buf.Write([]byte{0xFF, marker})
+	_ = binary.Write(buf, binary.BigEndian, uint16(2+len(header)+len(payload)))
+	buf.Write(header)
+	buf.Write(payload)
+}
+
+func embedPNGMetadata(encoded []byte, meta Metadata) ([]byte, error) {
+	// Metadata chunks go right after IHDR, which keeps iCCP ahead of PLTE/IDAT.
+	ihdrEnd := len(pngSignature) + 8 + 13 + 4
+	if !bytes.HasPrefix(encoded, pngSignature) || len(encoded) < ihdrEnd || string(encoded[12:16]) != "IHDR" {
+		return nil, errors.New("invalid png data")
+	}
+
+	var chunks bytes.Buffer
+	if len(meta.ICC) > 0 {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(meta.ICC); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		payload := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+		writePNGChunk(&chunks, "iCCP", payload)
+	}
+	if len(meta.EXIF) > 0 {
+		writePNGChunk(&chunks, "eXIf", meta.EXIF)
+	}
+	if len(meta.XMP) > 0 {
+		payload := append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), meta.XMP...)
+		writePNGChunk(&chunks, "iTXt", payload)
+	}
+
+	out := make([]byte, 0, len(encoded)+chunks.Len())
+	out = append(out, encoded[:ihdrEnd]...)
+	out = append(out, chunks.Bytes()...)
+	out = append(out, encoded[ihdrEnd:]...)
+	return out, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, chunkType string, payload []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte(chunkType))
+	_, _ = crc.Write(payload)
+	buf.WriteString(chunkType)
+	buf.Write(payload)
+	_ = binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+func resetEXIFOrientation(exif []byte) []byte {
+	// Rewrite the IFD0 orientation tag to 1 (top-left) in a copy of the TIFF payload.
+	if len(exif) < 8 {
+		return exif
+	}
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return exif
+	}
+	out := append([]byte(nil), exif...)
+	ifd := int(order.Uint32(out[4:8]))
+	if ifd+2 > len(out) {
+		return out
+	}
+	count := int(order.Uint16(out[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(out) {
+			break
+		}
+		if order.Uint16(out[entry:entry+2]) == exifOrientation {
+			order.PutUint16(out[entry+8:entry+10], 1)
+			break
+		}
+	}
+	return out
+}
+
+func stripEXIFThumbnail(exif []byte) []byte {
+	// Unlink IFD1 from IFD0 and zero the thumbnail it describes, in a copy of the TIFF payload.
+	// Zeroing instead of cutting keeps every other offset in the payload valid.
+	if len(exif) < 8 {
+		return exif
+	}
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return exif
+	}
+	out := append([]byte(nil), exif...)
+	ifd0 := int(order.Uint32(out[4:8]))
+	if ifd0 < 8 || ifd0+2 > len(out) {
+		return out
+	}
+	next := ifd0 + 2 + int(order.Uint16(out[ifd0:ifd0+2]))*12
+	if next+4 > len(out) {
+		return out
+	}
+	ifd1 := int(order.Uint32(out[next : next+4]))
+	order.PutUint32(out[next:next+4], 0)
+	if ifd1 < 8 || ifd1+2 > len(out) {
+		return out
+	}
+
+	count := int(order.Uint16(out[ifd1 : ifd1+2]))
+	end := min(ifd1+2+count*12+4, len(out))
+	thumbOffset, thumbLength := 0, 0
+	for entry := ifd1 + 2; entry+12 <= end; entry += 12 {
+		switch order.Uint16(out[entry : entry+2]) {
+		case exifThumbnailOffset:
+			thumbOffset = int(order.Uint32(out[entry+8 : entry+12]))
+		case exifThumbnailLength:
+			thumbLength = int(order.Uint32(out[entry+8 : entry+12]))
+		}
+	}
+	clear(out[ifd1:end])
+	if thumbOffset >= 8 && thumbLength > 0 && thumbOffset <= len(out) {
+		clear(out[thumbOffset:min(thumbOffset+thumbLength, len(out))])
+	}
+	return out
+}
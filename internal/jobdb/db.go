@@ -3,8 +3,12 @@ package jobdb
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -17,16 +21,73 @@ type Job struct {
 	Payload   json.RawMessage
 	Result    json.RawMessage
 	Error     sql.NullString
+	Attempts  int
 	CreatedAt string
 	UpdatedAt string
 }
 
+type Upload struct {
+	// A signed-URL source upload; ObjectName is where the client PUTs the image.
+	ID          string
+	ObjectName  string
+	ContentType string
+	ExpiresAt   string
+	CreatedAt   string
+	// ConsumedAt is set once a job has used the upload.
+	ConsumedAt sql.NullString
+}
+
 type OutboxMessage struct {
 	ID      string
 	JobID   string
 	Payload json.RawMessage
 }
 
+type WebhookMessage struct {
+	// Attempts includes the delivery currently being made.
+	ID       string
+	JobID    string
+	URL      string
+	Payload  json.RawMessage
+	Attempts int
+}
+
+type DeletionMessage struct {
+	// Storage cleanup for a deleted job; Attempts includes the run currently being made.
+	ID       string
+	JobID    string
+	Prefix   string
+	Attempts int
+}
+
+type WebhookEvent struct {
+	// Snapshot of a job that reached done or failed, queued for its callbackUrl. It holds the
+	// internal result, so it is rendered in the public job shape before delivery.
+	JobID     string          `json:"jobId"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *string         `json:"error"`
+	CreatedAt string          `json:"createdAt"`
+	UpdatedAt string          `json:"updatedAt"`
+}
+
+// Job returns the job the event snapshots.
+func (e WebhookEvent) Job() Job {
+	job := Job{
+		ID:        e.JobID,
+		Status:    e.Status,
+		Attempts:  e.Attempts,
+		Result:    e.Result,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+	if e.Error != nil {
+		job.Error = sql.NullString{String: *e.Error, Valid: true}
+	}
+	return job
+}
+
 type IdempotencyRecord struct {
 	// Stored mapping for idempotent request replay.
 	Key         string
@@ -35,9 +96,44 @@ type IdempotencyRecord struct {
 	CreatedAt   string
 }
 
+type ListJobsFilter struct {
+	// Optional filters; empty strings are ignored. Created bounds are RFC3339 UTC strings.
+	Status         string
+	CreatedAfter   string
+	CreatedBefore  string
+	IdempotencyKey string
+	Limit          int
+	After          *JobCursor
+}
+
+type JobCursor struct {
+	// Position of the last job on the previous page.
+	CreatedAt string `json:"c"`
+	ID        string `json:"i"`
+}
+
 // Returned when the same idempotency key is reused with a different payload.
 var ErrIdempotencyKeyConflict = errors.New("idempotency key reused with different payload")
 
+// Returned when a list cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Returned when deleting a job a worker is still processing.
+var ErrJobInProgress = errors.New("job is in progress")
+
+// Returned when recording an object for a job that no longer exists.
+var ErrJobNotFound = errors.New("job not found")
+
+// Returned when a job names an upload that has expired or another job already used.
+var ErrUploadUnavailable = errors.New("upload expired or already used")
+
+// IsSharedObject reports whether name is a content-addressed crop (objects/) or a job source
+// (sources/), which jobs reference through job_objects. Deletions queued for them name one
+// object, removed only once no job references it.
+func IsSharedObject(name string) bool {
+	return strings.HasPrefix(name, "objects/") || strings.HasPrefix(name, "sources/")
+}
+
 func Open(dsn string) (*sql.DB, error) {
 	// Open a MySQL connection pool for job storage.
 	db, err := sql.Open("mysql", dsn)
@@ -73,6 +169,7 @@ func InsertJob(db *sql.DB, payload json.RawMessage) (Job, error) {
 		Payload:   payload,
 		Result:    nil,
 		Error:     sql.NullString{},
+		Attempts:  1,
 		CreatedAt: createdAt,
 		UpdatedAt: createdAt,
 	}, nil
@@ -102,6 +199,16 @@ func InsertJobWithOutbox(db *sql.DB, payload json.RawMessage) (Job, OutboxMessag
 		return Job{}, OutboxMessage{}, err
 	}
 
+	if err := insertSourceObjects(tx, jobID, payload, createdAt); err != nil {
+		_ = tx.Rollback()
+		return Job{}, OutboxMessage{}, err
+	}
+
+	if err := consumeUploads(tx, payload, createdAt); err != nil {
+		_ = tx.Rollback()
+		return Job{}, OutboxMessage{}, err
+	}
+
 	if _, err := tx.Exec(
 		`INSERT INTO outbox (id, job_id, payload, published_at, attempts, last_error, created_at, updated_at)
 		 VALUES (?, ?, ?, NULL, 0, NULL, ?, ?)`,
@@ -121,6 +228,7 @@ func InsertJobWithOutbox(db *sql.DB, payload json.RawMessage) (Job, OutboxMessag
 		Payload:   payload,
 		Result:    nil,
 		Error:     sql.NullString{},
+		Attempts:  1,
 		CreatedAt: createdAt,
 		UpdatedAt: createdAt,
 	}
@@ -185,6 +293,16 @@ func InsertJobWithOutboxAndIdempotency(db *sql.DB, payload json.RawMessage, idem
 		return Job{}, OutboxMessage{}, false, err
 	}
 
+	if err := insertSourceObjects(tx, jobID, payload, createdAt); err != nil {
+		_ = tx.Rollback()
+		return Job{}, OutboxMessage{}, false, err
+	}
+
+	if err := consumeUploads(tx, payload, createdAt); err != nil {
+		_ = tx.Rollback()
+		return Job{}, OutboxMessage{}, false, err
+	}
+
 	if _, err := tx.Exec(
 		`INSERT INTO outbox (id, job_id, payload, published_at, attempts, last_error, created_at, updated_at)
 		 VALUES (?, ?, ?, NULL, 0, NULL, ?, ?)`,
@@ -204,6 +322,7 @@ func InsertJobWithOutboxAndIdempotency(db *sql.DB, payload json.RawMessage, idem
 		Payload:   payload,
 		Result:    nil,
 		Error:     sql.NullString{},
+		Attempts:  1,
 		CreatedAt: createdAt,
 		UpdatedAt: createdAt,
 	}
@@ -211,6 +330,79 @@ func InsertJobWithOutboxAndIdempotency(db *sql.DB, payload json.RawMessage, idem
 	return job, OutboxMessage{ID: outboxID, JobID: jobID, Payload: outboxPayload}, false, nil
 }
 
+func insertSourceObjects(tx *sql.Tx, jobID string, payload json.RawMessage, createdAt string) error {
+	// Record the stored sources (uploads) a job reads as its references, so deleting the job
+	// also removes sources no other job uses.
+	for _, name := range SourceObjects(payload) {
+		if _, err := tx.Exec(
+			`INSERT IGNORE INTO job_objects (job_id, object_name, created_at) VALUES (?, ?, ?)`,
+			jobID, name, createdAt,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func consumeUploads(tx *sql.Tx, payload json.RawMessage, now string) error {
+	// Claim each signed-URL upload the job reads, so it serves exactly one job and only
+	// before it expires; a retried request with the same Idempotency-Key reuses its job instead.
+	for _, uploadID := range uploadIDs(payload) {
+		res, err := tx.Exec(
+			`UPDATE uploads SET consumed_at = ? WHERE id = ? AND consumed_at IS NULL AND expires_at > ?`,
+			now, uploadID, now,
+		)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return fmt.Errorf("%w: %s", ErrUploadUnavailable, uploadID)
+		}
+	}
+	return nil
+}
+
+func uploadIDs(payload json.RawMessage) []string {
+	var req struct {
+		Images []struct {
+			UploadID string `json:"uploadId"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil
+	}
+	var ids []string
+	for _, image := range req.Images {
+		if image.UploadID != "" && !slices.Contains(ids, image.UploadID) {
+			ids = append(ids, image.UploadID)
+		}
+	}
+	return ids
+}
+
+// SourceObjects returns the storage objects a job payload's images are read from.
+func SourceObjects(payload json.RawMessage) []string {
+	var req struct {
+		Images []struct {
+			SourceObject string `json:"sourceObject"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil
+	}
+	var names []string
+	for _, image := range req.Images {
+		if image.SourceObject != "" {
+			names = append(names, image.SourceObject)
+		}
+	}
+	return names
+}
+
 func GetIdempotencyRecord(db *sql.DB, idemKey string) (IdempotencyRecord, error) {
 	// Read the stored idempotency mapping for a key.
 	var record IdempotencyRecord
@@ -236,29 +428,126 @@ func isDuplicateKeyError(err error) bool {
 
 func GetJob(db *sql.DB, jobID string) (Job, bool, error) {
 	// Fetch a job by ID; ok=false when not found.
-	var payload string
-	var result sql.NullString
-	var errText sql.NullString
-	var job Job
-
 	row := db.QueryRow(
-		`SELECT id, status, payload, result, error, created_at, updated_at
+		`SELECT id, status, payload, result, error, attempts, created_at, updated_at
 		 FROM jobs WHERE id = ?`, jobID,
 	)
-	if err := row.Scan(&job.ID, &job.Status, &payload, &result, &errText, &job.CreatedAt, &job.UpdatedAt); err != nil {
+	job, err := scanJob(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Job{}, false, nil
 		}
 		return Job{}, false, err
 	}
 
+	return job, true, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (Job, error) {
+	// Scan the standard jobs column list into a Job.
+	var payload string
+	var result sql.NullString
+	var errText sql.NullString
+	var job Job
+
+	if err := row.Scan(&job.ID, &job.Status, &payload, &result, &errText, &job.Attempts, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return Job{}, err
+	}
+
 	job.Payload = json.RawMessage(payload)
 	if result.Valid {
 		job.Result = json.RawMessage(result.String)
 	}
 	job.Error = errText
 
-	return job, true, nil
+	return job, nil
+}
+
+func ListJobs(ctx context.Context, db *sql.DB, filter ListJobsFilter) ([]Job, *JobCursor, error) {
+	// List jobs newest first using keyset pagination on (created_at, id).
+	// One extra row is fetched to decide whether a next cursor exists.
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := `SELECT j.id, j.status, j.payload, j.result, j.error, j.attempts, j.created_at, j.updated_at FROM jobs j`
+	var where []string
+	var args []any
+	if filter.IdempotencyKey != "" {
+		query += ` JOIN idempotency_keys k ON k.job_id = j.id`
+		where = append(where, `k.idempotency_key = ?`)
+		args = append(args, filter.IdempotencyKey)
+	}
+	if filter.Status != "" {
+		where = append(where, `j.status = ?`)
+		args = append(args, filter.Status)
+	}
+	if filter.CreatedAfter != "" {
+		where = append(where, `j.created_at >= ?`)
+		args = append(args, filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != "" {
+		where = append(where, `j.created_at < ?`)
+		args = append(args, filter.CreatedBefore)
+	}
+	if filter.After != nil {
+		where = append(where, `(j.created_at < ? OR (j.created_at = ? AND j.id < ?))`)
+		args = append(args, filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY j.created_at DESC, j.id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(jobs) <= limit {
+		return jobs, nil, nil
+	}
+	jobs = jobs[:limit]
+	last := jobs[len(jobs)-1]
+	return jobs, &JobCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// EncodeCursor renders a cursor as an opaque URL-safe token.
+func EncodeCursor(cursor JobCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a token produced by EncodeCursor.
+func DecodeCursor(token string) (JobCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return JobCursor{}, ErrInvalidCursor
+	}
+	var cursor JobCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.CreatedAt == "" || cursor.ID == "" {
+		return JobCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
 }
 
 func ClaimOutboxBatch(ctx context.Context, db *sql.DB, limit int) ([]OutboxMessage, error) {
@@ -338,39 +627,94 @@ func RecordOutboxError(db *sql.DB, outboxID string, errMsg string) error {
 	return err
 }
 
-func StartJob(db *sql.DB, jobID string) (bool, error) {
-	// Start a pending job by transitioning it to in_progress if it is still pending.
+func StartJob(db *sql.DB, jobID string, lease time.Duration) (string, bool, error) {
+	// Start a job by transitioning it to in_progress if it is still pending, or if the worker
+	// that claimed it has not renewed its lease and is presumed dead. Returns the claim token
+	// that RenewJob, CompleteJob, FailJob and ReleaseJob must present.
 	tx, err := db.Begin()
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
 
+	now := NowISO()
+	claimToken := uuid.NewString()
 	result, err := tx.Exec(
-		`UPDATE jobs SET status = 'in_progress', updated_at = ? WHERE id = ? AND status = 'pending'`,
-		NowISO(), jobID,
+		`UPDATE jobs SET status = 'in_progress', claimed_at = ?, claim_token = ?, updated_at = ?
+		 WHERE id = ? AND (status = 'pending' OR (status = 'in_progress' AND (claimed_at IS NULL OR claimed_at < ?)))`,
+		now, claimToken, now, jobID, leaseCutoff(lease),
 	)
 	if err != nil {
 		_ = tx.Rollback()
-		return false, err
+		return "", false, err
 	}
 	affected, err := result.RowsAffected()
 	if err != nil {
 		_ = tx.Rollback()
-		return false, err
+		return "", false, err
 	}
 
 	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+
+	if affected != 1 {
+		return "", false, nil
+	}
+	return claimToken, true, nil
+}
+
+// RenewJob extends the lease of a claim that is still current; false means the job was
+// cancelled, finished or taken over and the holder should stop working on it.
+func RenewJob(ctx context.Context, db *sql.DB, jobID, claimToken string) (bool, error) {
+	now := NowISO()
+	result, err := db.ExecContext(
+		ctx,
+		`UPDATE jobs SET claimed_at = ? WHERE id = ? AND status = 'in_progress' AND claim_token = ?`,
+		now, jobID, claimToken,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 1 {
+		return true, nil
+	}
+	// MySQL reports no affected row when claimed_at already holds this second's timestamp.
+	var current string
+	err = db.QueryRowContext(
+		ctx,
+		`SELECT id FROM jobs WHERE id = ? AND status = 'in_progress' AND claim_token = ?`,
+		jobID, claimToken,
+	).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
 		return false, err
 	}
+	return true, nil
+}
 
-	return affected == 1, nil
+func ReleaseJob(db *sql.DB, jobID, claimToken string) error {
+	// Return an in_progress job to pending so the next delivery or poll claims it again.
+	_, err := db.Exec(
+		`UPDATE jobs SET status = 'pending', claimed_at = NULL, claim_token = NULL, updated_at = ?
+		 WHERE id = ? AND status = 'in_progress' AND claim_token = ?`,
+		NowISO(), jobID, claimToken,
+	)
+	return err
 }
 
-func ClaimJob(ctx context.Context, db *sql.DB) (Job, bool, error) {
-	// Atomically select and mark a pending job as in_progress.
+func ClaimJob(ctx context.Context, db *sql.DB, lease time.Duration) (Job, string, bool, error) {
+	// Atomically select and mark a pending job as in_progress; in_progress jobs whose lease was
+	// not renewed within lease are taken over as well, so a crashed worker's jobs run again.
+	// Returns the job and its claim token, as StartJob does.
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return Job{}, false, err
+		return Job{}, "", false, err
 	}
 
 	var job Job
@@ -378,52 +722,797 @@ func ClaimJob(ctx context.Context, db *sql.DB) (Job, bool, error) {
 	row := tx.QueryRowContext(
 		ctx,
 		`SELECT id, payload FROM jobs
-		 WHERE status = 'pending'
+		 WHERE status = 'pending' OR (status = 'in_progress' AND (claimed_at IS NULL OR claimed_at < ?))
 		 ORDER BY created_at
 		 LIMIT 1
 		 FOR UPDATE SKIP LOCKED`,
+		leaseCutoff(lease),
 	)
 	if err := row.Scan(&job.ID, &payload); err != nil {
 		_ = tx.Rollback()
 		if errors.Is(err, sql.ErrNoRows) {
-			return Job{}, false, nil
+			return Job{}, "", false, nil
 		}
-		return Job{}, false, err
+		return Job{}, "", false, err
 	}
 
 	job.Payload = json.RawMessage(payload)
 	job.Status = "in_progress"
 	job.UpdatedAt = NowISO()
+	claimToken := uuid.NewString()
 	if _, err := tx.ExecContext(
 		ctx,
-		`UPDATE jobs SET status = 'in_progress', updated_at = ? WHERE id = ?`,
-		job.UpdatedAt, job.ID,
+		`UPDATE jobs SET status = 'in_progress', claimed_at = ?, claim_token = ?, updated_at = ? WHERE id = ?`,
+		job.UpdatedAt, claimToken, job.UpdatedAt, job.ID,
 	); err != nil {
 		_ = tx.Rollback()
-		return Job{}, false, err
+		return Job{}, "", false, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return Job{}, false, err
+		return Job{}, "", false, err
 	}
 
-	return job, true, nil
+	return job, claimToken, true, nil
 }
 
-func CompleteJob(db *sql.DB, jobID string, result json.RawMessage) error {
-	// Mark a job as done and store its result JSON.
-	_, err := db.Exec(
-		`UPDATE jobs SET status = 'done', result = ?, error = NULL, updated_at = ? WHERE id = ?`,
-		string(result), NowISO(), jobID,
+func leaseCutoff(lease time.Duration) string {
+	return time.Now().UTC().Add(-lease).Format(time.RFC3339)
+}
+
+// ReclaimJobs puts up to limit in_progress jobs claimed before the cutoff back to pending and
+// queues a fresh outbox message for each, so push and pull workers get them again; returns how
+// many jobs were reclaimed. Jobs already in flight when claimed_at was added had it backfilled
+// from updated_at, so they are not reclaimed before their lease runs out.
+func ReclaimJobs(ctx context.Context, db *sql.DB, claimedBefore time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id FROM jobs
+		 WHERE status = 'in_progress' AND (claimed_at IS NULL OR claimed_at < ?)
+		 ORDER BY created_at
+		 LIMIT ?
+		 FOR UPDATE SKIP LOCKED`,
+		claimedBefore.UTC().Format(time.RFC3339), limit,
 	)
-	return err
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			_ = tx.Rollback()
+			return 0, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	now := NowISO()
+	for _, id := range jobIDs {
+		payload, err := json.Marshal(map[string]string{"jobId": id})
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`UPDATE jobs SET status = 'pending', claimed_at = NULL, claim_token = NULL, updated_at = ? WHERE id = ?`,
+			now, id,
+		); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO outbox (id, job_id, payload, published_at, attempts, last_error, created_at, updated_at)
+			 VALUES (?, ?, ?, NULL, 0, NULL, ?, ?)`,
+			uuid.NewString(), id, string(payload), now, now,
+		); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(jobIDs)), nil
 }
 
-func FailJob(db *sql.DB, jobID string, errMsg string) error {
-	// Mark a job as failed and store the error string.
-	_, err := db.Exec(
-		`UPDATE jobs SET status = 'failed', error = ?, updated_at = ? WHERE id = ?`,
-		errMsg, NowISO(), jobID,
+func CompleteJob(db *sql.DB, jobID, claimToken string, result json.RawMessage) error {
+	// Mark a job as done and store its result JSON. Only the worker holding the current claim
+	// may do so: cancelled jobs stay cancelled and a run whose claim was taken over is dropped.
+	return finishJob(db, jobID,
+		`UPDATE jobs SET status = 'done', result = ?, error = NULL, claimed_at = NULL, claim_token = NULL, updated_at = ?
+		 WHERE id = ? AND status = 'in_progress' AND claim_token = ?`,
+		string(result), NowISO(), jobID, claimToken,
+	)
+}
+
+func FailJob(db *sql.DB, jobID, claimToken string, errMsg string) error {
+	// Mark a job as failed and store the error string, under the same claim rule as CompleteJob.
+	return finishJob(db, jobID,
+		`UPDATE jobs SET status = 'failed', error = ?, claimed_at = NULL, claim_token = NULL, updated_at = ?
+		 WHERE id = ? AND status = 'in_progress' AND claim_token = ?`,
+		errMsg, NowISO(), jobID, claimToken,
+	)
+}
+
+func finishJob(db *sql.DB, jobID string, query string, args ...any) error {
+	// Apply a terminal status update and, in the same transaction, queue the job's webhook.
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if affected == 1 {
+		if err := enqueueWebhook(tx, jobID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func enqueueWebhook(tx *sql.Tx, jobID string) error {
+	// Queue a notification for the job's callbackUrl; jobs without one are skipped.
+	row := tx.QueryRow(
+		`SELECT id, status, payload, result, error, attempts, created_at, updated_at
+		 FROM jobs WHERE id = ?`, jobID,
+	)
+	job, err := scanJob(row)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		CallbackURL string `json:"callbackUrl"`
+	}
+	if err := json.Unmarshal(job.Payload, &req); err != nil || req.CallbackURL == "" {
+		return nil
+	}
+
+	event := WebhookEvent{
+		JobID:     job.ID,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		Result:    job.Result,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	if job.Error.Valid {
+		event.Error = &job.Error.String
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := NowISO()
+	_, err = tx.Exec(
+		`INSERT INTO webhook_outbox (id, job_id, url, payload, delivered_at, attempts, next_attempt_at, last_error, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, NULL, 0, ?, NULL, ?, ?)`,
+		uuid.NewString(), job.ID, req.CallbackURL, string(payload), now, now, now,
 	)
 	return err
 }
+
+func ClaimWebhookBatch(ctx context.Context, db *sql.DB, limit int, maxAttempts int, lease time.Duration) ([]WebhookMessage, error) {
+	// Claim due, undelivered webhooks like ClaimOutboxBatch, and push next_attempt_at out by
+	// the lease so other publishers skip them while this one is delivering.
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := NowISO()
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id, job_id, url, payload, attempts FROM webhook_outbox
+		 WHERE delivered_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		 ORDER BY next_attempt_at
+		 LIMIT ?
+		 FOR UPDATE SKIP LOCKED`,
+		maxAttempts, now, limit,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []WebhookMessage
+	for rows.Next() {
+		var msg WebhookMessage
+		var payload string
+		if err := rows.Scan(&msg.ID, &msg.JobID, &msg.URL, &payload, &msg.Attempts); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		msg.Payload = json.RawMessage(payload)
+		msg.Attempts++
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	leaseUntil := time.Now().UTC().Add(lease).Format(time.RFC3339)
+	for _, msg := range messages {
+		if _, err := tx.Exec(
+			`UPDATE webhook_outbox SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+			leaseUntil, now, msg.ID,
+		); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func MarkWebhookDelivered(db *sql.DB, webhookID string) error {
+	_, err := db.Exec(
+		`UPDATE webhook_outbox SET delivered_at = ?, last_error = NULL, updated_at = ? WHERE id = ?`,
+		NowISO(), NowISO(), webhookID,
+	)
+	return err
+}
+
+func RecordWebhookError(db *sql.DB, webhookID string, errMsg string, nextAttemptAt time.Time) error {
+	_, err := db.Exec(
+		`UPDATE webhook_outbox SET last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		errMsg, nextAttemptAt.UTC().Format(time.RFC3339), NowISO(), webhookID,
+	)
+	return err
+}
+
+func CancelJob(db *sql.DB, jobID string) (bool, error) {
+	// Move a pending or in-progress job to cancelled; returns false when the job was in any other state.
+	result, err := db.Exec(
+		`UPDATE jobs SET status = 'cancelled', updated_at = ? WHERE id = ? AND status IN ('pending', 'in_progress')`,
+		NowISO(), jobID,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func RetryJob(db *sql.DB, jobID string) (OutboxMessage, bool, error) {
+	// Reset a failed job to pending, bump its attempt counter and enqueue a fresh outbox
+	// message in one transaction; returns false when the job is not in the failed state.
+	now := NowISO()
+	outboxID := uuid.NewString()
+	outboxPayload, err := json.Marshal(map[string]string{"jobId": jobID})
+	if err != nil {
+		return OutboxMessage{}, false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return OutboxMessage{}, false, err
+	}
+
+	result, err := tx.Exec(
+		`UPDATE jobs SET status = 'pending', result = NULL, error = NULL, attempts = attempts + 1, updated_at = ?
+		 WHERE id = ? AND status = 'failed'`,
+		now, jobID,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return OutboxMessage{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return OutboxMessage{}, false, err
+	}
+	if affected != 1 {
+		_ = tx.Rollback()
+		return OutboxMessage{}, false, nil
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO outbox (id, job_id, payload, published_at, attempts, last_error, created_at, updated_at)
+		 VALUES (?, ?, ?, NULL, 0, NULL, ?, ?)`,
+		outboxID, jobID, string(outboxPayload), now, now,
+	); err != nil {
+		_ = tx.Rollback()
+		return OutboxMessage{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return OutboxMessage{}, false, err
+	}
+
+	return OutboxMessage{ID: outboxID, JobID: jobID, Payload: outboxPayload}, true, nil
+}
+
+func DeleteJob(db *sql.DB, jobID string, deleteObjectsAfter time.Time) (bool, error) {
+	// Remove the job with its outbox, webhook, idempotency and upload rows, and queue removal of
+	// its crops and sources from storage, in one transaction. Returns false when the job does not
+	// exist and ErrJobInProgress while it is in_progress.
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM jobs WHERE id = ? FOR UPDATE`, jobID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return false, nil
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if status == "in_progress" {
+		_ = tx.Rollback()
+		return false, ErrJobInProgress
+	}
+
+	if err := purgeJob(tx, jobID, deleteObjectsAfter); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func ExpireJobs(ctx context.Context, db *sql.DB, createdBefore time.Time, limit int) (int, error) {
+	// Delete up to limit finished jobs created before the cutoff the way DeleteJob does,
+	// queueing their crops for removal; returns how many jobs were deleted.
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id FROM jobs
+		 WHERE created_at < ? AND status IN ('done', 'failed', 'cancelled')
+		 ORDER BY created_at
+		 LIMIT ?
+		 FOR UPDATE SKIP LOCKED`,
+		createdBefore.UTC().Format(time.RFC3339), limit,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			_ = tx.Rollback()
+			return 0, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, id := range jobIDs {
+		if err := purgeJob(tx, id, now); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(jobIDs), nil
+}
+
+func purgeJob(tx *sql.Tx, jobID string, deleteObjectsAfter time.Time) error {
+	// Remove every row belonging to the job, including the uploads rows of its sources, and
+	// queue deletion of crops/{jobID}/ plus each shared object and source it referenced;
+	// those stay in storage while other jobs reference them.
+	shared, err := jobObjects(tx, jobID)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		`DELETE FROM idempotency_keys WHERE job_id = ?`,
+		`DELETE FROM outbox WHERE job_id = ?`,
+		`DELETE FROM webhook_outbox WHERE job_id = ?`,
+		`DELETE uploads FROM uploads JOIN job_objects ON job_objects.object_name = uploads.object_name WHERE job_objects.job_id = ?`,
+		`DELETE FROM job_objects WHERE job_id = ?`,
+		`DELETE FROM jobs WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, jobID); err != nil {
+			return err
+		}
+	}
+
+	now := NowISO()
+	for _, prefix := range append([]string{"crops/" + jobID + "/"}, shared...) {
+		if _, err := tx.Exec(
+			`INSERT INTO deletion_outbox (id, job_id, prefix, completed_at, attempts, next_attempt_at, last_error, created_at, updated_at)
+			 VALUES (?, ?, ?, NULL, 0, ?, NULL, ?, ?)`,
+			uuid.NewString(), jobID, prefix, deleteObjectsAfter.UTC().Format(time.RFC3339), now, now,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jobObjects(tx *sql.Tx, jobID string) ([]string, error) {
+	rows, err := tx.Query(`SELECT object_name FROM job_objects WHERE job_id = ?`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func AddJobObject(ctx context.Context, db *sql.DB, jobID, objectName string) error {
+	// Record that the job references a shared object; workers call this before reusing or
+	// uploading it, so a concurrent DeleteSharedObject either sees the reference or finishes
+	// first and the worker uploads the object again. Returns ErrJobNotFound once the job is gone.
+	result, err := db.ExecContext(
+		ctx,
+		`INSERT IGNORE INTO job_objects (job_id, object_name, created_at)
+		 SELECT id, ?, ? FROM jobs WHERE id = ?`,
+		objectName, NowISO(), jobID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 1 {
+		return err
+	}
+	// Nothing inserted: either the reference already exists or the job was deleted.
+	var exists bool
+	err = db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM job_objects WHERE job_id = ? AND object_name = ?)`,
+		jobID, objectName,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	return nil
+}
+
+func DeleteSharedObject(ctx context.Context, db *sql.DB, objectName string, remove func(ctx context.Context) error) error {
+	// Call remove unless a job references the object. The locking read keeps the object's
+	// index range locked until remove returns, so AddJobObject waits for the deletion.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var jobID string
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT job_id FROM job_objects WHERE object_name = ? LIMIT 1 FOR UPDATE`,
+		objectName,
+	).Scan(&jobID)
+	if err == nil {
+		return tx.Rollback()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := remove(ctx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgePublishedOutbox deletes up to limit outbox rows published before the cutoff.
+func PurgePublishedOutbox(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error) {
+	return deleteBatch(ctx, db, `DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < ? LIMIT ?`, before, limit)
+}
+
+// PurgeIdempotencyKeys expires up to limit idempotency keys created before the cutoff;
+// reusing an expired key creates a new job.
+func PurgeIdempotencyKeys(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error) {
+	return deleteBatch(ctx, db, `DELETE FROM idempotency_keys WHERE created_at < ? LIMIT ?`, before, limit)
+}
+
+// PurgeDeliveredWebhooks deletes up to limit webhook_outbox rows delivered before the cutoff.
+func PurgeDeliveredWebhooks(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error) {
+	return deleteBatch(ctx, db, `DELETE FROM webhook_outbox WHERE delivered_at IS NOT NULL AND delivered_at < ? LIMIT ?`, before, limit)
+}
+
+// PurgeCompletedDeletions deletes up to limit deletion_outbox rows completed before the cutoff.
+func PurgeCompletedDeletions(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error) {
+	return deleteBatch(ctx, db, `DELETE FROM deletion_outbox WHERE completed_at IS NOT NULL AND completed_at < ? LIMIT ?`, before, limit)
+}
+
+func deleteBatch(ctx context.Context, db *sql.DB, query string, before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	result, err := db.ExecContext(ctx, query, before.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func ClaimDeletionBatch(ctx context.Context, db *sql.DB, limit int, maxAttempts int, lease time.Duration) ([]DeletionMessage, error) {
+	// Claim due storage deletions like ClaimWebhookBatch, leasing them for the run.
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := NowISO()
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id, job_id, prefix, attempts FROM deletion_outbox
+		 WHERE completed_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		 ORDER BY next_attempt_at
+		 LIMIT ?
+		 FOR UPDATE SKIP LOCKED`,
+		maxAttempts, now, limit,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []DeletionMessage
+	for rows.Next() {
+		var msg DeletionMessage
+		if err := rows.Scan(&msg.ID, &msg.JobID, &msg.Prefix, &msg.Attempts); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		msg.Attempts++
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	leaseUntil := time.Now().UTC().Add(lease).Format(time.RFC3339)
+	for _, msg := range messages {
+		if _, err := tx.Exec(
+			`UPDATE deletion_outbox SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+			leaseUntil, now, msg.ID,
+		); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func MarkDeletionDone(db *sql.DB, deletionID string) error {
+	_, err := db.Exec(
+		`UPDATE deletion_outbox SET completed_at = ?, last_error = NULL, updated_at = ? WHERE id = ?`,
+		NowISO(), NowISO(), deletionID,
+	)
+	return err
+}
+
+func RecordDeletionError(db *sql.DB, deletionID string, errMsg string, nextAttemptAt time.Time) error {
+	_, err := db.Exec(
+		`UPDATE deletion_outbox SET last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		errMsg, nextAttemptAt.UTC().Format(time.RFC3339), NowISO(), deletionID,
+	)
+	return err
+}
+
+func GetJobStatuses(ctx context.Context, db *sql.DB, jobIDs []string) (map[string]string, error) {
+	// Look up many job statuses in one query; ids that do not exist are absent from the map.
+	statuses := make(map[string]string, len(jobIDs))
+	if len(jobIDs) == 0 {
+		return statuses, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(jobIDs)), ",")
+	args := make([]any, len(jobIDs))
+	for i, id := range jobIDs {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, status FROM jobs WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		statuses[id] = status
+	}
+	return statuses, rows.Err()
+}
+
+func InsertUpload(db *sql.DB, objectName, contentType string, expiresAt time.Time) (Upload, error) {
+	upload := Upload{
+		ID:          uuid.NewString(),
+		ObjectName:  objectName,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+		CreatedAt:   NowISO(),
+	}
+	_, err := db.Exec(
+		`INSERT INTO uploads (id, object_name, content_type, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		upload.ID, upload.ObjectName, upload.ContentType, upload.ExpiresAt, upload.CreatedAt,
+	)
+	if err != nil {
+		return Upload{}, err
+	}
+	return upload, nil
+}
+
+func GetUpload(db *sql.DB, uploadID string) (Upload, bool, error) {
+	var upload Upload
+	err := db.QueryRow(
+		`SELECT id, object_name, content_type, expires_at, created_at, consumed_at FROM uploads WHERE id = ?`, uploadID,
+	).Scan(&upload.ID, &upload.ObjectName, &upload.ContentType, &upload.ExpiresAt, &upload.CreatedAt, &upload.ConsumedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Upload{}, false, nil
+	}
+	if err != nil {
+		return Upload{}, false, err
+	}
+	return upload, true, nil
+}
+
+// ExpireUploads deletes up to limit uploads rows that expired before the cutoff without a job
+// referencing their object, and queues those objects for deletion; the deletion row's job_id
+// holds the upload ID. Returns how many uploads were removed.
+func ExpireUploads(ctx context.Context, db *sql.DB, expiredBefore time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id, object_name FROM uploads
+		 WHERE expires_at < ?
+		   AND NOT EXISTS (SELECT 1 FROM job_objects WHERE job_objects.object_name = uploads.object_name)
+		 ORDER BY expires_at
+		 LIMIT ?
+		 FOR UPDATE SKIP LOCKED`,
+		expiredBefore.UTC().Format(time.RFC3339), limit,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	var uploads []Upload
+	for rows.Next() {
+		var upload Upload
+		if err := rows.Scan(&upload.ID, &upload.ObjectName); err != nil {
+			rows.Close()
+			_ = tx.Rollback()
+			return 0, err
+		}
+		uploads = append(uploads, upload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	now := NowISO()
+	for _, upload := range uploads {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM uploads WHERE id = ?`, upload.ID); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO deletion_outbox (id, job_id, prefix, completed_at, attempts, next_attempt_at, last_error, created_at, updated_at)
+			 VALUES (?, ?, ?, NULL, 0, ?, NULL, ?, ?)`,
+			uuid.NewString(), upload.ID, upload.ObjectName, now, now, now,
+		); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(uploads)), nil
+}
+
+func IsJobCancelled(ctx context.Context, db *sql.DB, jobID string) (bool, error) {
+	// Cheap status probe used by workers between crops.
+	var status string
+	row := db.QueryRowContext(ctx, `SELECT status FROM jobs WHERE id = ?`, jobID)
+	if err := row.Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return status == "cancelled", nil
+}
@@ -1,9 +1,13 @@
 package jobdb
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"regexp"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
 )
 
@@ -27,3 +31,130 @@ func TestIsDuplicateKeyError(t *testing.T) {
 		t.Fatalf("expected false for non-duplicate mysql error")
 	}
 }
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := JobCursor{CreatedAt: "2026-01-14T22:29:01Z", ID: "e3d48021-ef94-4850-9dc9-2210e4e9dcb3"}
+	decoded, err := DecodeCursor(EncodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != cursor {
+		t.Fatalf("unexpected cursor: %+v", decoded)
+	}
+
+	if _, err := DecodeCursor("not-a-cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestSourceObjects(t *testing.T) {
+	payload := []byte(`{"images":[{"imageUrl":"https://example.com/a.png"},{"sourceObject":"sources/ab.png"},{"sourceObject":"sources/uploads/u.png"}]}`)
+	names := SourceObjects(payload)
+	if len(names) != 2 || names[0] != "sources/ab.png" || names[1] != "sources/uploads/u.png" {
+		t.Fatalf("unexpected source objects: %v", names)
+	}
+	if !IsSharedObject("sources/ab.png") || !IsSharedObject("objects/ab/cd.jpg") || IsSharedObject("crops/job/") {
+		t.Fatalf("unexpected shared object classification")
+	}
+}
+
+func TestInsertJobRejectsUsedUpload(t *testing.T) {
+	const uploadID = "5b0c6e3e-93f4-4c52-8d8e-6f2f7a9f1c01"
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO jobs`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT IGNORE INTO job_objects`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT IGNORE INTO job_objects`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE uploads SET consumed_at = ? WHERE id = ? AND consumed_at IS NULL AND expires_at > ?`)).
+		WithArgs(sqlmock.AnyArg(), uploadID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	payload := []byte(`{"images":[{"uploadId":"` + uploadID + `","sourceObject":"sources/uploads/u.png"},{"uploadId":"` + uploadID + `","sourceObject":"sources/uploads/u.png"}]}`)
+	if _, _, err := InsertJobWithOutbox(db, payload); !errors.Is(err, ErrUploadUnavailable) {
+		t.Fatalf("expected ErrUploadUnavailable, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	const jobID = "0d6b8a2e-6c39-4f7e-a3f1-0a5f3c2b9d11"
+	cases := []struct {
+		name     string
+		affected int64
+		want     bool
+	}{
+		{"pending", 1, true},
+		{"in_progress", 1, true},
+		{"done", 0, false},
+	}
+	for _, tc := range cases {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		// The status guard is what keeps finished jobs from being cancelled.
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET status = 'cancelled', updated_at = ? WHERE id = ? AND status IN ('pending', 'in_progress')`)).
+			WithArgs(sqlmock.AnyArg(), jobID).
+			WillReturnResult(sqlmock.NewResult(0, tc.affected))
+
+		cancelled, err := CancelJob(db, jobID)
+		if err != nil {
+			t.Fatalf("%s: cancel: %v", tc.name, err)
+		}
+		if cancelled != tc.want {
+			t.Fatalf("%s: expected cancelled=%v, got %v", tc.name, tc.want, cancelled)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("%s: unexpected queries: %v", tc.name, err)
+		}
+		db.Close()
+	}
+}
+
+func TestFinishLeavesCancelledJobAlone(t *testing.T) {
+	const (
+		jobID      = "0d6b8a2e-6c39-4f7e-a3f1-0a5f3c2b9d11"
+		claimToken = "c4a1f0de-3b7e-4f5e-9d61-2f9e8b7a6c55"
+	)
+	cases := []struct {
+		name   string
+		query  string
+		finish func(db *sql.DB) error
+	}{
+		{"complete", `UPDATE jobs SET status = 'done'`, func(db *sql.DB) error {
+			return CompleteJob(db, jobID, claimToken, json.RawMessage(`{"croppedImageUrls":["https://cdn.example/a.png"]}`))
+		}},
+		{"fail", `UPDATE jobs SET status = 'failed'`, func(db *sql.DB) error {
+			return FailJob(db, jobID, claimToken, "fetch failed")
+		}},
+	}
+	for _, tc := range cases {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		// A cancelled job, like one another worker took over, matches no row, so neither its
+		// status nor a webhook is written.
+		mock.ExpectBegin()
+		mock.ExpectExec(`(?s)`+regexp.QuoteMeta(tc.query)+`.*`+regexp.QuoteMeta(`WHERE id = ? AND status = 'in_progress' AND claim_token = ?`)).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), jobID, claimToken).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		if err := tc.finish(db); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("%s: unexpected queries: %v", tc.name, err)
+		}
+		db.Close()
+	}
+}
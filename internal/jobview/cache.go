@@ -0,0 +1,72 @@
+package jobview
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+// maxCachedURLs bounds the cache; expired entries are dropped once it is reached.
+const maxCachedURLs = 10000
+
+type cachedURL struct {
+	url       string
+	refreshAt time.Time
+}
+
+// CachedSigner is Signer with a cache: a URL is handed out again while more than half its ttl
+// remains, so lists, long-polls and SSE streams re-reading the same jobs do not sign every
+// object on every read.
+func CachedSigner(signer uploader.URLSigner, ttl time.Duration) SignFunc {
+	sign := Signer(signer, ttl)
+	var (
+		mu      sync.Mutex
+		entries = make(map[string]cachedURL)
+	)
+	return func(ctx context.Context, objectNames []string) ([]string, error) {
+		now := time.Now()
+		urls := make([]string, len(objectNames))
+		var missing []string
+		mu.Lock()
+		for i, name := range objectNames {
+			if entry, ok := entries[name]; ok && now.Before(entry.refreshAt) {
+				urls[i] = entry.url
+			} else {
+				missing = append(missing, name)
+			}
+		}
+		mu.Unlock()
+		if len(missing) == 0 {
+			return urls, nil
+		}
+
+		signed, err := sign(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		refreshAt := now.Add(ttl / 2)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(entries)+len(missing) > maxCachedURLs {
+			for name, entry := range entries {
+				if !now.Before(entry.refreshAt) {
+					delete(entries, name)
+				}
+			}
+			if len(entries)+len(missing) > maxCachedURLs {
+				clear(entries)
+			}
+		}
+		next := 0
+		for i := range urls {
+			if urls[i] == "" {
+				urls[i] = signed[next]
+				entries[missing[next]] = cachedURL{url: signed[next], refreshAt: refreshAt}
+				next++
+			}
+		}
+		return urls, nil
+	}
+}
@@ -0,0 +1,137 @@
+// Package jobview renders stored jobs in the public shape GET /jobs/{id} returns, for the API
+// and for completion webhooks.
+package jobview
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"image-api/internal/api"
+	"image-api/internal/jobdb"
+	"image-api/internal/uploader"
+
+	"github.com/google/uuid"
+)
+
+// SignFunc returns readable URLs for private result objects, in order.
+type SignFunc func(ctx context.Context, objectNames []string) ([]string, error)
+
+// Response builds the public view of job. With sign set (private mode), croppedImageUrls are
+// minted from the result's object names instead of the stored URLs; object names themselves
+// are never exposed.
+func Response(ctx context.Context, job jobdb.Job, sign SignFunc) (api.JobResponse, error) {
+	resp := api.JobResponse{
+		Id:        mustParseUUID(job.ID),
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		Error:     extractError(job.Error),
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	urls := CroppedImageURLs(job.Result)
+	if sign != nil {
+		objects := CroppedObjects(job.Result)
+		if len(objects) == 0 {
+			urls = nil
+		} else {
+			signed, err := sign(ctx, objects)
+			if err != nil {
+				return api.JobResponse{}, err
+			}
+			urls = signed
+		}
+	}
+	if len(urls) > 0 {
+		resp.CroppedImageUrls = &urls
+	}
+	return resp, nil
+}
+
+// Signer returns a SignFunc minting GET URLs valid for ttl.
+func Signer(signer uploader.URLSigner, ttl time.Duration) SignFunc {
+	return func(ctx context.Context, objectNames []string) ([]string, error) {
+		urls := make([]string, 0, len(objectNames))
+		for _, objectName := range objectNames {
+			signed, err := signer.SignURL(ctx, objectName, uploader.SignOptions{
+				Method:  http.MethodGet,
+				Expires: ttl,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("sign %s: %w", objectName, err)
+			}
+			urls = append(urls, signed.URL)
+		}
+		return urls, nil
+	}
+}
+
+// CroppedImageURLs pulls croppedImageUrls (or the legacy croppedImageUrl) from a stored job
+// result.
+func CroppedImageURLs(result json.RawMessage) []string {
+	if len(result) == 0 {
+		return nil
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(result, &payload); err != nil {
+		return nil
+	}
+
+	if rawList, ok := payload["croppedImageUrls"]; ok {
+		items, ok := rawList.([]any)
+		if !ok {
+			return nil
+		}
+		var urls []string
+		for _, item := range items {
+			if url, ok := item.(string); ok && url != "" {
+				urls = append(urls, url)
+			}
+		}
+		if len(urls) > 0 {
+			return urls
+		}
+	}
+
+	if raw, ok := payload["croppedImageUrl"]; ok {
+		if url, ok := raw.(string); ok && url != "" {
+			return []string{url}
+		}
+	}
+
+	return nil
+}
+
+// CroppedObjects pulls croppedObjects (storage object names) from a stored job result.
+func CroppedObjects(result json.RawMessage) []string {
+	if len(result) == 0 {
+		return nil
+	}
+	var payload struct {
+		CroppedObjects []string `json:"croppedObjects"`
+	}
+	if err := json.Unmarshal(result, &payload); err != nil {
+		return nil
+	}
+	return payload.CroppedObjects
+}
+
+func extractError(errText sql.NullString) *string {
+	// Return a non-empty error string if present.
+	if !errText.Valid || errText.String == "" {
+		return nil
+	}
+	return &errText.String
+}
+
+func mustParseUUID(id string) uuid.UUID {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil
+	}
+	return parsed
+}
@@ -0,0 +1,77 @@
+package jobview
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"image-api/internal/jobdb"
+	"image-api/internal/uploader"
+)
+
+func TestResponseHidesObjectNames(t *testing.T) {
+	job := jobdb.Job{
+		ID:        "7f1f5c1e-2d7e-4a53-9f52-8f0c0c1b7e11",
+		Status:    "done",
+		Attempts:  1,
+		Result:    json.RawMessage(`{"croppedImageUrls":["https://cdn.example/crops/a.png"],"croppedObjects":["crops/a.png"]}`),
+		CreatedAt: "2026-01-01T00:00:00Z",
+		UpdatedAt: "2026-01-01T00:00:05Z",
+	}
+
+	resp, err := Response(context.Background(), job, nil)
+	if err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	if resp.CroppedImageUrls == nil || (*resp.CroppedImageUrls)[0] != "https://cdn.example/crops/a.png" {
+		t.Fatalf("expected stored urls, got %v", resp.CroppedImageUrls)
+	}
+	body, _ := json.Marshal(resp)
+	if strings.Contains(string(body), "croppedObjects") {
+		t.Fatalf("object names leaked: %s", body)
+	}
+
+	sign := func(ctx context.Context, objectNames []string) ([]string, error) {
+		urls := make([]string, len(objectNames))
+		for i, name := range objectNames {
+			urls[i] = "https://signed.example/" + name + "?sig=x"
+		}
+		return urls, nil
+	}
+	resp, err = Response(context.Background(), job, sign)
+	if err != nil {
+		t.Fatalf("signed response: %v", err)
+	}
+	if resp.CroppedImageUrls == nil || (*resp.CroppedImageUrls)[0] != "https://signed.example/crops/a.png?sig=x" {
+		t.Fatalf("expected signed urls, got %v", resp.CroppedImageUrls)
+	}
+}
+
+type countingSigner struct{ calls int }
+
+func (c *countingSigner) SignURL(ctx context.Context, objectName string, opts uploader.SignOptions) (uploader.SignedURL, error) {
+	c.calls++
+	return uploader.SignedURL{URL: "https://signed.example/" + objectName}, nil
+}
+
+func TestCachedSignerReusesURLs(t *testing.T) {
+	signer := &countingSigner{}
+	sign := CachedSigner(signer, 15*time.Minute)
+	ctx := context.Background()
+
+	if _, err := sign(ctx, []string{"crops/a.png", "crops/b.png"}); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	urls, err := sign(ctx, []string{"crops/b.png", "crops/c.png", "crops/a.png"})
+	if err != nil {
+		t.Fatalf("sign again: %v", err)
+	}
+	if signer.calls != 3 {
+		t.Fatalf("expected only new objects to be signed, got %d calls", signer.calls)
+	}
+	if urls[0] != "https://signed.example/crops/b.png" || urls[1] != "https://signed.example/crops/c.png" || urls[2] != "https://signed.example/crops/a.png" {
+		t.Fatalf("urls out of order: %v", urls)
+	}
+}
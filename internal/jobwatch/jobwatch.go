@@ -0,0 +1,107 @@
+package jobwatch
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// StatusFunc returns the current status of each known job in ids; missing ids were deleted.
+type StatusFunc func(ctx context.Context, ids []string) (map[string]string, error)
+
+// Notifier lets many requests wait for jobs to finish while a single loop polls their
+// statuses in one query per interval, instead of every waiter polling on its own.
+type Notifier struct {
+	fetch    StatusFunc
+	interval time.Duration
+
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// IsFinished reports whether status is outside pending/in_progress.
+func IsFinished(status string) bool {
+	return status != "pending" && status != "in_progress"
+}
+
+func New(fetch StatusFunc, interval time.Duration) *Notifier {
+	return &Notifier{
+		fetch:    fetch,
+		interval: interval,
+		waiters:  make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe returns a channel that is closed once jobID finishes, and a func that
+// releases the subscription early. The release func is safe to call after close.
+func (n *Notifier) Subscribe(jobID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	n.mu.Lock()
+	if n.waiters[jobID] == nil {
+		n.waiters[jobID] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[jobID][ch] = struct{}{}
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if set, ok := n.waiters[jobID]; ok {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(n.waiters, jobID)
+			}
+		}
+	}
+}
+
+// Notify wakes every waiter on jobID, e.g. after this process cancelled the job itself.
+func (n *Notifier) Notify(jobID string) {
+	n.mu.Lock()
+	set := n.waiters[jobID]
+	delete(n.waiters, jobID)
+	n.mu.Unlock()
+
+	for ch := range set {
+		close(ch)
+	}
+}
+
+// Run polls watched jobs every interval until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.poll(ctx)
+		}
+	}
+}
+
+func (n *Notifier) poll(ctx context.Context) {
+	n.mu.Lock()
+	ids := make([]string, 0, len(n.waiters))
+	for id := range n.waiters {
+		ids = append(ids, id)
+	}
+	n.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	statuses, err := n.fetch(ctx, ids)
+	if err != nil {
+		slog.Error("job status poll failed", "jobs", len(ids), "err", err)
+		return
+	}
+	for _, id := range ids {
+		status, ok := statuses[id]
+		if !ok || IsFinished(status) {
+			n.Notify(id)
+		}
+	}
+}
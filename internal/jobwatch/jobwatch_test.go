@@ -0,0 +1,80 @@
+package jobwatch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotifierWakesWaitersWithOneQuery(t *testing.T) {
+	var calls atomic.Int32
+	var finished atomic.Bool
+	fetch := func(ctx context.Context, ids []string) (map[string]string, error) {
+		calls.Add(1)
+		status := "in_progress"
+		if finished.Load() {
+			status = "done"
+		}
+		out := make(map[string]string, len(ids))
+		for _, id := range ids {
+			out[id] = status
+		}
+		return out, nil
+	}
+	n := New(fetch, 10*time.Millisecond)
+
+	ch1, release1 := n.Subscribe("job-1")
+	defer release1()
+	ch2, release2 := n.Subscribe("job-1")
+	defer release2()
+
+	n.poll(context.Background())
+	select {
+	case <-ch1:
+		t.Fatalf("waiter woke before job finished")
+	default:
+	}
+
+	finished.Store(true)
+	n.poll(context.Background())
+	for _, ch := range []<-chan struct{}{ch1, ch2} {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("waiter not woken after job finished")
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected one fetch per poll, got %d", got)
+	}
+
+	// Nothing is watched now, so polling must not query.
+	n.poll(context.Background())
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected no fetch without waiters, got %d", got)
+	}
+}
+
+func TestNotifierReleaseAndMissingJob(t *testing.T) {
+	fetch := func(ctx context.Context, ids []string) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	n := New(fetch, time.Hour)
+
+	_, release := n.Subscribe("released")
+	release()
+	release()
+	if len(n.waiters) != 0 {
+		t.Fatalf("expected waiter to be released")
+	}
+
+	ch, release := n.Subscribe("deleted")
+	defer release()
+	n.poll(context.Background())
+	select {
+	case <-ch:
+	default:
+		t.Fatalf("expected waiter on missing job to be woken")
+	}
+}
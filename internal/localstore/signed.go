@@ -0,0 +1,155 @@
+package localstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// SignURL returns BaseURL/object with expires, max and an HMAC-SHA256 signature over
+// method, object, content type, expiry and size limit; NewFileHandler verifies it.
+func (u *Uploader) SignURL(ctx context.Context, objectName string, opts uploader.SignOptions) (uploader.SignedURL, error) {
+	_ = ctx
+	if len(u.SigningKey) == 0 {
+		return uploader.SignedURL{}, uploader.ErrSigningNotConfigured
+	}
+	if u.BaseURL == "" {
+		return uploader.SignedURL{}, errors.New("local storage base url is required")
+	}
+	clean, err := sanitizeObjectName(objectName)
+	if err != nil {
+		return uploader.SignedURL{}, err
+	}
+	escaped, err := escapePath(clean)
+	if err != nil {
+		return uploader.SignedURL{}, err
+	}
+
+	expires := time.Now().Add(opts.Expires).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if opts.MaxBytes > 0 {
+		query.Set("max", strconv.FormatInt(opts.MaxBytes, 10))
+	}
+	query.Set("signature", u.signature(opts.Method, clean, opts.ContentType, expires, opts.MaxBytes))
+
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		headers["Content-Type"] = opts.ContentType
+	}
+	return uploader.SignedURL{
+		URL:     fmt.Sprintf("%s/%s?%s", u.BaseURL, escaped, query.Encode()),
+		Headers: headers,
+	}, nil
+}
+
+// VerifySignature checks a request made against a URL from SignURL and returns the signed size limit.
+func (u *Uploader) VerifySignature(method, objectName, contentType string, query url.Values, now time.Time) (int64, error) {
+	if len(u.SigningKey) == 0 {
+		return 0, uploader.ErrSigningNotConfigured
+	}
+	clean, err := sanitizeObjectName(objectName)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	var maxBytes int64
+	if raw := query.Get("max"); raw != "" {
+		if maxBytes, err = strconv.ParseInt(raw, 10, 64); err != nil || maxBytes < 0 {
+			return 0, ErrInvalidSignature
+		}
+	}
+
+	expected := u.signature(method, clean, contentType, expires, maxBytes)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return 0, ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return 0, ErrSignatureExpired
+	}
+	return maxBytes, nil
+}
+
+func (u *Uploader) signature(method, objectName, contentType string, expires, maxBytes int64) string {
+	mac := hmac.New(sha256.New, u.SigningKey)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%d", strings.ToUpper(method), objectName, contentType, expires, maxBytes)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewFileHandler serves stored objects over GET (signed GET URLs only when u.Private, and always
+// for customer sources under sources/) and accepts PUT uploads to URLs from SignURL, capped at
+// maxBytes (or the smaller signed limit).
+// Mount it with the BaseURL path stripped.
+func NewFileHandler(u *Uploader, maxBytes int64) http.Handler {
+	fileServer := http.FileServer(http.Dir(u.Dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			objectName := strings.TrimPrefix(r.URL.Path, "/")
+			if u.Private || strings.HasPrefix(path.Clean("/"+objectName), "/sources/") {
+				if _, err := u.VerifySignature(http.MethodGet, objectName, "", r.URL.Query(), time.Now()); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+			}
+			fileServer.ServeHTTP(w, r)
+		case http.MethodPut:
+			u.servePut(w, r, maxBytes)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (u *Uploader) servePut(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	objectName := strings.TrimPrefix(r.URL.Path, "/")
+	contentType := r.Header.Get("Content-Type")
+	signedMax, err := u.VerifySignature(http.MethodPut, objectName, contentType, r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if signedMax > 0 && (maxBytes <= 0 || signedMax < maxBytes) {
+		maxBytes = signedMax
+	}
+
+	reader := io.Reader(r.Body)
+	if maxBytes > 0 {
+		reader = io.LimitReader(r.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		http.Error(w, "object exceeds maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if _, err := u.Upload(r.Context(), objectName, data, contentType); err != nil {
+		http.Error(w, "failed to store object", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -2,18 +2,29 @@ package localstore
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"mime"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+
+	"image-api/internal/uploader"
 )
 
 type Uploader struct {
 	Dir     string
 	BaseURL string
+	// SigningKey enables HMAC-signed URLs; leave empty to disable SignURL.
+	SigningKey []byte
+	// Private makes NewFileHandler require a signed URL for GET/HEAD as well as PUT.
+	Private bool
 }
 
 func NewUploader(dir string, baseURL string) *Uploader {
@@ -21,7 +32,6 @@ func NewUploader(dir string, baseURL string) *Uploader {
 }
 
 func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
-	_ = ctx
 	_ = contentType
 
 	if u.Dir == "" {
@@ -44,9 +54,20 @@ func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, c
 		return "", err
 	}
 
+	return u.URL(ctx, clean)
+}
+
+func (u *Uploader) URL(ctx context.Context, objectName string) (string, error) {
+	// Objects are served from BaseURL (the worker's /files); without one there is no URL.
+	_ = ctx
+
 	if u.BaseURL == "" {
 		return "", nil
 	}
+	clean, err := sanitizeObjectName(objectName)
+	if err != nil {
+		return "", err
+	}
 	escaped, err := escapePath(clean)
 	if err != nil {
 		return "", err
@@ -54,6 +75,120 @@ func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, c
 	return fmt.Sprintf("%s/%s", u.BaseURL, escaped), nil
 }
 
+func (u *Uploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	_ = ctx
+
+	if u.Dir == "" {
+		return nil, errors.New("local storage dir is required")
+	}
+	clean, err := sanitizeObjectName(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(u.Dir, filepath.FromSlash(clean)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", uploader.ErrNotFound, clean)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (u *Uploader) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	// Local files carry no metadata: the content type comes from the extension and the
+	// checksum is computed on each call.
+	reader, err := u.Open(ctx, objectName)
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	defer reader.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(objectName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return uploader.ObjectInfo{
+		Size:        size,
+		ContentType: contentType,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func (u *Uploader) Delete(ctx context.Context, objectName string) error {
+	// Remove the file, then any directories it leaves empty below Dir.
+	_ = ctx
+
+	if u.Dir == "" {
+		return errors.New("local storage dir is required")
+	}
+	clean, err := sanitizeObjectName(objectName)
+	if err != nil {
+		return err
+	}
+
+	fullPath := filepath.Join(u.Dir, filepath.FromSlash(clean))
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	root := filepath.Clean(u.Dir)
+	for dir := filepath.Dir(fullPath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	// Walk only the directory holding the prefix, then match names against the full prefix.
+	_ = ctx
+
+	if u.Dir == "" {
+		return nil, errors.New("local storage dir is required")
+	}
+	for _, part := range strings.Split(prefix, "/") {
+		if part == ".." {
+			return nil, errors.New("invalid prefix")
+		}
+	}
+
+	root := filepath.Join(u.Dir, filepath.FromSlash(path.Dir("/"+prefix)))
+	if strings.HasSuffix(prefix, "/") {
+		root = filepath.Join(u.Dir, filepath.FromSlash(prefix))
+	}
+	var names []string
+	err := filepath.WalkDir(root, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(u.Dir, fullPath)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
 func sanitizeObjectName(objectName string) (string, error) {
 	for _, part := range strings.Split(objectName, "/") {
 		if part == ".." {
@@ -1,7 +1,19 @@
 package localstore
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"image-api/internal/uploader"
 )
 
 func TestSanitizeObjectName(t *testing.T) {
@@ -28,3 +40,162 @@ func TestEscapePath(t *testing.T) {
 		t.Fatalf("unexpected escaped path: %s", escaped)
 	}
 }
+
+func TestOpenRoundTrip(t *testing.T) {
+	u := NewUploader(t.TempDir(), "http://localhost/files")
+	if _, err := u.Upload(context.Background(), "sources/a.png", []byte("data"), "image/png"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	reader, err := u.Open(context.Background(), "sources/a.png")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("unexpected data %q: %v", data, err)
+	}
+
+	if _, err := u.Open(context.Background(), "sources/missing.png"); !errors.Is(err, uploader.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStatAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	u := NewUploader(dir, "http://localhost/files")
+	if _, err := u.Upload(context.Background(), "crops/job/0_0.png", []byte("data"), "image/png"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	info, err := u.Stat(context.Background(), "crops/job/0_0.png")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size != 4 || info.ContentType != "image/png" || info.Checksum != "8d777f385d3dfec8815d20f7496026dc" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := u.Delete(context.Background(), "crops/job/0_0.png"); err != nil {
+			t.Fatalf("delete %d: %v", i, err)
+		}
+	}
+	if _, err := u.Stat(context.Background(), "crops/job/0_0.png"); !errors.Is(err, uploader.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "crops")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected empty directories to be removed, got %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("storage dir removed: %v", err)
+	}
+}
+
+func TestSignedPutUpload(t *testing.T) {
+	u := NewUploader(t.TempDir(), "http://files.local/files")
+	u.SigningKey = []byte("secret")
+	handler := http.StripPrefix("/files/", NewFileHandler(u, 1024))
+
+	signed, err := u.SignURL(context.Background(), "sources/up.png", uploader.SignOptions{
+		Method:      http.MethodPut,
+		ContentType: "image/png",
+		MaxBytes:    8,
+		Expires:     time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	put := func(target, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put(signed.URL, "image/jpeg", "data"); code != http.StatusForbidden {
+		t.Fatalf("expected content type mismatch to be rejected, got %d", code)
+	}
+	if code := put(strings.Replace(signed.URL, "up.png", "other.png", 1), "image/png", "data"); code != http.StatusForbidden {
+		t.Fatalf("expected other object to be rejected, got %d", code)
+	}
+	if code := put(signed.URL, "image/png", "too much data"); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected signed size limit, got %d", code)
+	}
+	if code := put(signed.URL, "image/png", "data"); code != http.StatusOK {
+		t.Fatalf("expected upload to succeed, got %d", code)
+	}
+
+	reader, err := u.Open(context.Background(), "sources/up.png")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "data" {
+		t.Fatalf("unexpected stored data %q", data)
+	}
+
+	query := url.Values{"expires": {"1"}, "signature": {u.signature(http.MethodPut, "sources/up.png", "image/png", 1, 0)}}
+	if _, err := u.VerifySignature(http.MethodPut, "sources/up.png", "image/png", query, time.Now()); !errors.Is(err, ErrSignatureExpired) {
+		t.Fatalf("expected ErrSignatureExpired, got %v", err)
+	}
+}
+
+func TestPrivateGetRequiresSignature(t *testing.T) {
+	u := NewUploader(t.TempDir(), "http://files.local/files")
+	u.SigningKey = []byte("secret")
+	u.Private = true
+	handler := http.StripPrefix("/files/", NewFileHandler(u, 1024))
+	if _, err := u.Upload(context.Background(), "crops/job/0_0.png", []byte("data"), "image/png"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	get := func(target string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	if code := get("http://files.local/files/crops/job/0_0.png"); code != http.StatusForbidden {
+		t.Fatalf("expected unsigned GET to be rejected, got %d", code)
+	}
+	signed, err := u.SignURL(context.Background(), "crops/job/0_0.png", uploader.SignOptions{Method: http.MethodGet, Expires: time.Minute})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if code := get(signed.URL); code != http.StatusOK {
+		t.Fatalf("expected signed GET to succeed, got %d", code)
+	}
+	if code := get(strings.Replace(signed.URL, "0_0.png", "0_1.png", 1)); code != http.StatusForbidden {
+		t.Fatalf("expected signature for another object to be rejected, got %d", code)
+	}
+}
+
+func TestSourcesRequireSignatureWhenPublic(t *testing.T) {
+	u := NewUploader(t.TempDir(), "http://files.local/files")
+	u.SigningKey = []byte("secret")
+	handler := http.StripPrefix("/files/", NewFileHandler(u, 1024))
+	for _, name := range []string{"crops/job/0_0.png", "sources/ab.png"} {
+		if _, err := u.Upload(context.Background(), name, []byte("data"), "image/png"); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+	}
+
+	get := func(target string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+	if code := get("http://files.local/files/crops/job/0_0.png"); code != http.StatusOK {
+		t.Fatalf("expected public crop to be served, got %d", code)
+	}
+	if code := get("http://files.local/files/sources/ab.png"); code != http.StatusForbidden {
+		t.Fatalf("expected unsigned source GET to be rejected, got %d", code)
+	}
+	if code := get("http://files.local/files/crops/../sources/ab.png"); code == http.StatusOK {
+		t.Fatalf("expected source reached through .. to be rejected")
+	}
+}
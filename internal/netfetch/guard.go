@@ -0,0 +1,121 @@
+package netfetch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+// Special-purpose ranges not covered by the netip.Addr helpers.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// Teredo and local-use NAT64 tunnel to IPv4 addresses that cannot be checked reliably.
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// IPv6 ranges that embed an IPv4 address, which must be allowed itself: 6to4 carries it in
+// bits 16-47, well-known NAT64 in the last 32 bits.
+var (
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+	nat64Prefix     = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+// Guard rejects connections to loopback, private, link-local (including cloud metadata)
+// and other non-public addresses unless they fall inside AllowedCIDRs.
+type Guard struct {
+	AllowedCIDRs []netip.Prefix
+}
+
+// NewClient returns an HTTP client whose dialer enforces guard on every connection,
+// including redirects, and ignores proxy environment variables so the check sees the real peer.
+func NewClient(timeout time.Duration, guard Guard) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guard.control,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// ParseCIDRs parses a comma-separated CIDR list such as "10.20.0.0/16,fd00:1::/64".
+func ParseCIDRs(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", part, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Allowed reports whether a connection to addr may be made.
+func (g Guard) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.AllowedCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if embedded, ok := embeddedIPv4(addr); ok {
+		return g.Allowed(embedded)
+	}
+	return true
+}
+
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case sixToFourPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}), true
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}), true
+	}
+	return netip.Addr{}, false
+}
+
+func (g Guard) control(network, address string, _ syscall.RawConn) error {
+	// Runs after DNS resolution with the concrete IP being dialed, so rebinding cannot slip past it.
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !g.Allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package netfetch
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// HostPolicy restricts which source hosts may be fetched.
+// Patterns are exact hostnames ("cdn.example.com") or wildcard subdomains ("*.example.com",
+// which matches any subdomain but not example.com itself). Deny wins over Allow, and an
+// empty Allow list permits every host that is not denied.
+type HostPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// ParseHostPatterns splits a comma-separated pattern list, normalizing case and trailing dots.
+func ParseHostPatterns(raw string) []string {
+	var patterns []string
+	for _, part := range strings.Split(raw, ",") {
+		if pattern := normalizeHost(part); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Check returns ErrHostNotAllowed when rawURL's host is denied or not allowlisted.
+func (p HostPolicy) Check(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrInvalidURL
+	}
+	host := normalizeHost(parsed.Hostname())
+	if host == "" {
+		return ErrInvalidURL
+	}
+	if matchAny(p.Deny, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	if len(p.Allow) > 0 && !matchAny(p.Allow, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+func matchAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matchHost(normalizeHost(pattern), host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
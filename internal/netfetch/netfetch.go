@@ -19,16 +19,20 @@ var (
 type Options struct {
 	MaxBytes     int64
 	MaxRedirects int
+	Hosts        HostPolicy
 }
 
 func Download(ctx context.Context, client *http.Client, rawURL string, opts Options) ([]byte, string, error) {
-	// Download with scheme checks, redirect limits, and size guards (Content-Length check + hard read cap).
+	// Download with scheme/host checks, redirect limits, and size guards (Content-Length check + hard read cap).
 	if client == nil {
 		client = http.DefaultClient
 	}
 	if !isAllowedScheme(rawURL) {
 		return nil, "", ErrInvalidURL
 	}
+	if err := opts.Hosts.Check(rawURL); err != nil {
+		return nil, "", err
+	}
 
 	clientCopy := *client
 	redirectLimit := opts.MaxRedirects
@@ -42,7 +46,7 @@ func Download(ctx context.Context, client *http.Client, rawURL string, opts Opti
 		if !isAllowedScheme(req.URL.String()) {
 			return ErrInvalidURL
 		}
-		return nil
+		return opts.Hosts.Check(req.URL.String())
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
@@ -55,7 +59,7 @@ func Download(ctx context.Context, client *http.Client, rawURL string, opts Opti
 
 	resp, err := clientCopy.Do(req)
 	if err != nil {
-		return nil, "", err
+		return nil, "", fmt.Errorf("%w: %w", ErrDownloadFailed, err)
 	}
 	defer resp.Body.Close()
 
@@ -74,7 +78,7 @@ func Download(ctx context.Context, client *http.Client, rawURL string, opts Opti
 
 	data, err := io.ReadAll(limit)
 	if err != nil {
-		return nil, "", err
+		return nil, "", fmt.Errorf("%w: %w", ErrDownloadFailed, err)
 	}
 	if opts.MaxBytes > 0 && int64(len(data)) > opts.MaxBytes {
 		return nil, "", ErrTooLarge
@@ -3,9 +3,12 @@ package netfetch
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+	"time"
 )
 
 func TestDownloadTooLarge(t *testing.T) {
@@ -31,3 +34,66 @@ func TestDownloadRejectsScheme(t *testing.T) {
 		t.Fatalf("expected ErrInvalidURL, got %v", err)
 	}
 }
+
+func TestGuardedClientBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(time.Second, Guard{})
+	_, _, err := Download(context.Background(), client, server.URL, Options{})
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("expected ErrBlockedAddress, got %v", err)
+	}
+
+	allowed, err := ParseCIDRs("127.0.0.0/8, ::1/128")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client = NewClient(time.Second, Guard{AllowedCIDRs: allowed})
+	if _, _, err := Download(context.Background(), client, server.URL, Options{}); err != nil {
+		t.Fatalf("expected allowlisted download to succeed, got %v", err)
+	}
+}
+
+func TestGuardAllowed(t *testing.T) {
+	guard := Guard{}
+	for _, raw := range []string{"169.254.169.254", "10.0.0.1", "192.168.1.1", "::1", "fd00::1", "::ffff:127.0.0.1", "100.64.0.1"} {
+		if guard.Allowed(netip.MustParseAddr(raw)) {
+			t.Fatalf("expected %s to be blocked", raw)
+		}
+	}
+	if !guard.Allowed(netip.MustParseAddr("93.184.216.34")) {
+		t.Fatalf("expected public address to be allowed")
+	}
+
+	// Tunnel and translation addresses are judged by the IPv4 address they reach.
+	for _, raw := range []string{"2002:a9fe:a9fe::1", "2002:7f00:1::", "64:ff9b::a9fe:a9fe", "64:ff9b::10.0.0.1", "2001:0:4136:e378:8000:63bf:3fff:fdd2", "64:ff9b:1::5db8:d822"} {
+		if guard.Allowed(netip.MustParseAddr(raw)) {
+			t.Fatalf("expected %s to be blocked", raw)
+		}
+	}
+	for _, raw := range []string{"2002:5db8:d822::1", "64:ff9b::93.184.216.34"} {
+		if !guard.Allowed(netip.MustParseAddr(raw)) {
+			t.Fatalf("expected %s to be allowed", raw)
+		}
+	}
+}
+
+func TestHostPolicyCheck(t *testing.T) {
+	policy := HostPolicy{
+		Allow: ParseHostPatterns("cdn.example.com, *.assets.example.com"),
+		Deny:  ParseHostPatterns("private.assets.example.com"),
+	}
+	for _, raw := range []string{"https://cdn.example.com/a.jpg", "https://img.assets.example.com:8443/a.jpg", "https://CDN.Example.com./a.jpg"} {
+		if err := policy.Check(raw); err != nil {
+			t.Fatalf("expected %s to be allowed, got %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"https://assets.example.com/a.jpg", "https://private.assets.example.com/a.jpg", "https://evil.com/a.jpg", "https://cdn.example.com.evil.com/a.jpg"} {
+		if err := policy.Check(raw); !errors.Is(err, ErrHostNotAllowed) {
+			t.Fatalf("expected %s to be rejected, got %v", raw, err)
+		}
+	}
+}
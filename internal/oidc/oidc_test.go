@@ -0,0 +1,118 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testAudience = "image-worker"
+	testEmail    = "push@project.iam.gserviceaccount.com"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwks(kid string, key *rsa.PublicKey) []byte {
+	doc, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	return doc
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":            "https://accounts.google.com",
+		"aud":            testAudience,
+		"sub":            "1234",
+		"email":          testEmail,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyChecksClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks("k1", &key.PublicKey), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	keys, err := LoadKeysFile(path)
+	if err != nil {
+		t.Fatalf("load jwks: %v", err)
+	}
+	v := NewVerifier(keys, GoogleIssuers, testAudience, testEmail)
+
+	if _, err := v.Verify(context.Background(), signToken(t, key, "k1", validClaims())); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cases := map[string]struct {
+		token string
+		want  error
+	}{
+		"wrong audience": {signToken(t, key, "k1", with(validClaims(), "aud", "someone-else")), ErrInvalidToken},
+		"wrong issuer":   {signToken(t, key, "k1", with(validClaims(), "iss", "https://evil.example")), ErrInvalidToken},
+		"wrong email":    {signToken(t, key, "k1", with(validClaims(), "email", "other@example.com")), ErrInvalidToken},
+		"unverified":     {signToken(t, key, "k1", with(validClaims(), "email_verified", false)), ErrInvalidToken},
+		"expired":        {signToken(t, key, "k1", with(validClaims(), "exp", time.Now().Add(-time.Hour).Unix())), ErrInvalidToken},
+		"forged":         {signToken(t, other, "k1", validClaims()), ErrInvalidToken},
+		"unknown kid":    {signToken(t, key, "k2", validClaims()), ErrUnknownKey},
+		"malformed":      {"not-a-jwt", ErrInvalidToken},
+	}
+	for name, tc := range cases {
+		if _, err := v.Verify(context.Background(), tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func with(claims map[string]any, key string, value any) map[string]any {
+	claims[key] = value
+	return claims
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/pubsub/jobs", nil)
+	if _, err := BearerToken(r); !errors.Is(err, ErrMissingToken) {
+		t.Fatalf("expected ErrMissingToken, got %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer abc.def.ghi")
+	if token, err := BearerToken(r); err != nil || token != "abc.def.ghi" {
+		t.Fatalf("unexpected token %q: %v", token, err)
+	}
+}
@@ -0,0 +1,173 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"image-api/internal/backoff"
+	"image-api/internal/jobdb"
+	"image-api/internal/uploader"
+)
+
+// Policy sets how long rows are kept; a zero age keeps them forever.
+type Policy struct {
+	// JobAge applies to finished jobs, whose crops are queued for deletion with them.
+	JobAge time.Duration
+	// OutboxAge applies to published outbox rows, delivered webhooks and completed deletions.
+	OutboxAge         time.Duration
+	IdempotencyKeyAge time.Duration
+	// UploadAge applies to uploads past their expiry that no job used; their objects go too.
+	UploadAge time.Duration
+	// SyncResultAge applies to POST /crop results under sync/{day}/, by day of creation.
+	SyncResultAge time.Duration
+	// JobLease is how long a worker may hold an in_progress job before it is put back to
+	// pending and published again; it must match the workers' JOB_LEASE_SECONDS.
+	JobLease  time.Duration
+	BatchSize int
+}
+
+// Stats counts the rows removed by one Apply.
+type Stats struct {
+	Jobs            int64
+	OutboxRows      int64
+	WebhookRows     int64
+	DeletionRows    int64
+	IdempotencyKeys int64
+	ReclaimedJobs   int64
+	Uploads         int64
+}
+
+type purgeFunc func(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error)
+
+// Apply deletes everything older than the policy allows, one batch at a time so no single
+// statement holds locks for long.
+func Apply(ctx context.Context, db *sql.DB, policy Policy, now time.Time) (Stats, error) {
+	var stats Stats
+	if policy.BatchSize <= 0 {
+		return stats, errors.New("batch size must be positive")
+	}
+
+	expireJobs := func(ctx context.Context, db *sql.DB, before time.Time, limit int) (int64, error) {
+		n, err := jobdb.ExpireJobs(ctx, db, before, limit)
+		return int64(n), err
+	}
+	steps := []struct {
+		name  string
+		age   time.Duration
+		purge purgeFunc
+		count *int64
+	}{
+		{"job_claims", policy.JobLease, jobdb.ReclaimJobs, &stats.ReclaimedJobs},
+		{"jobs", policy.JobAge, expireJobs, &stats.Jobs},
+		{"outbox", policy.OutboxAge, jobdb.PurgePublishedOutbox, &stats.OutboxRows},
+		{"webhook_outbox", policy.OutboxAge, jobdb.PurgeDeliveredWebhooks, &stats.WebhookRows},
+		{"deletion_outbox", policy.OutboxAge, jobdb.PurgeCompletedDeletions, &stats.DeletionRows},
+		{"idempotency_keys", policy.IdempotencyKeyAge, jobdb.PurgeIdempotencyKeys, &stats.IdempotencyKeys},
+		{"uploads", policy.UploadAge, jobdb.ExpireUploads, &stats.Uploads},
+	}
+	for _, step := range steps {
+		if step.age <= 0 {
+			continue
+		}
+		before := now.Add(-step.age)
+		for {
+			n, err := step.purge(ctx, db, before, policy.BatchSize)
+			if err != nil {
+				return stats, fmt.Errorf("purge %s: %w", step.name, err)
+			}
+			*step.count += n
+			if n < int64(policy.BatchSize) {
+				break
+			}
+		}
+	}
+	return stats, nil
+}
+
+// ProcessDeletions runs one batch of queued storage deletions, rescheduling failures with
+// backoff; it returns how many deletions were claimed.
+func ProcessDeletions(ctx context.Context, db *sql.DB, store uploader.Uploader, batchSize, maxAttempts int, timeout time.Duration) (int, error) {
+	messages, err := jobdb.ClaimDeletionBatch(ctx, db, batchSize, maxAttempts, timeout+time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		deleteCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := deleteQueued(deleteCtx, db, store, msg.Prefix)
+		cancel()
+		if err != nil {
+			slog.Warn("object deletion failed", "deletion_id", msg.ID, "job_id", msg.JobID, "attempt", msg.Attempts, "err", err)
+			next := time.Now().Add(backoff.Delay(msg.Attempts))
+			if err := jobdb.RecordDeletionError(db, msg.ID, err.Error(), next); err != nil {
+				slog.Error("record deletion error failed", "deletion_id", msg.ID, "err", err)
+			}
+			continue
+		}
+		if err := jobdb.MarkDeletionDone(db, msg.ID); err != nil {
+			slog.Error("mark deletion done failed", "deletion_id", msg.ID, "err", err)
+		}
+	}
+	return len(messages), nil
+}
+
+func deleteQueued(ctx context.Context, db *sql.DB, store uploader.Uploader, prefix string) error {
+	// Shared objects are named exactly and only go once no job references them.
+	if jobdb.IsSharedObject(prefix) {
+		return jobdb.DeleteSharedObject(ctx, db, prefix, func(ctx context.Context) error {
+			return store.Delete(ctx, prefix)
+		})
+	}
+	return DeletePrefix(ctx, store, prefix)
+}
+
+// DeletePrefix deletes every object under prefix, continuing past failures; a retry lists
+// again and only sees the leftovers.
+func DeletePrefix(ctx context.Context, store uploader.Uploader, prefix string) error {
+	names, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		if err := store.Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncResultPrefix is where POST /crop stores results created on day.
+func SyncResultPrefix(day time.Time) string {
+	return "sync/" + day.UTC().Format(time.DateOnly) + "/"
+}
+
+// ExpireSyncResults deletes the POST /crop results of every day that ended before the cutoff,
+// continuing past failures; it returns how many objects were deleted. Objects outside the
+// sync/{day}/ layout are left alone.
+func ExpireSyncResults(ctx context.Context, store uploader.Uploader, before time.Time) (int, error) {
+	names, err := store.List(ctx, "sync/")
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var errs []error
+	for _, name := range names {
+		dayName, _, ok := strings.Cut(strings.TrimPrefix(name, "sync/"), "/")
+		day, err := time.Parse(time.DateOnly, dayName)
+		if !ok || err != nil || day.AddDate(0, 0, 1).After(before) {
+			continue
+		}
+		if err := store.Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", name, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
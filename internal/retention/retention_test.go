@@ -0,0 +1,105 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+type memoryStore struct {
+	objects map[string]bool
+	failing map[string]bool
+}
+
+func (s *memoryStore) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
+	s.objects[objectName] = true
+	return objectName, nil
+}
+
+func (s *memoryStore) URL(ctx context.Context, objectName string) (string, error) {
+	return objectName, nil
+}
+
+func (s *memoryStore) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	return nil, uploader.ErrNotFound
+}
+
+func (s *memoryStore) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	return uploader.ObjectInfo{}, uploader.ErrNotFound
+}
+
+func (s *memoryStore) Delete(ctx context.Context, objectName string) error {
+	if s.failing[objectName] {
+		return errors.New("boom")
+	}
+	delete(s.objects, objectName)
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func TestDeletePrefixContinuesPastFailures(t *testing.T) {
+	store := &memoryStore{
+		objects: map[string]bool{"crops/a/0_0.jpg": true, "crops/a/0_1.jpg": true, "crops/ab/0_0.jpg": true},
+		failing: map[string]bool{"crops/a/0_0.jpg": true},
+	}
+
+	err := DeletePrefix(context.Background(), store, "crops/a/")
+	if err == nil || !strings.Contains(err.Error(), "crops/a/0_0.jpg") {
+		t.Fatalf("expected failure for the failing object, got %v", err)
+	}
+	if store.objects["crops/a/0_1.jpg"] {
+		t.Fatalf("expected other objects to be deleted")
+	}
+	if !store.objects["crops/ab/0_0.jpg"] {
+		t.Fatalf("deleted an object outside the prefix")
+	}
+
+	delete(store.failing, "crops/a/0_0.jpg")
+	if err := DeletePrefix(context.Background(), store, "crops/a/"); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(store.objects) != 1 {
+		t.Fatalf("unexpected leftovers: %v", store.objects)
+	}
+}
+
+func TestApplyRequiresBatchSize(t *testing.T) {
+	if _, err := Apply(context.Background(), nil, Policy{JobAge: time.Hour}, time.Now()); err == nil {
+		t.Fatalf("expected error for zero batch size")
+	}
+}
+
+func TestExpireSyncResultsByDay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{objects: map[string]bool{
+		SyncResultPrefix(now.AddDate(0, 0, -3)) + "a/0_0.jpg": true,
+		SyncResultPrefix(now.AddDate(0, 0, -1)) + "b/0_0.jpg": true,
+		SyncResultPrefix(now) + "c/0_0.jpg":                   true,
+		"sync/legacy-uuid/0_0.jpg":                            true,
+	}}
+
+	deleted, err := ExpireSyncResults(context.Background(), store, now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 1 || store.objects["sync/2026-03-07/a/0_0.jpg"] {
+		t.Fatalf("expected only the oldest day to be deleted, got %d: %v", deleted, store.objects)
+	}
+	if len(store.objects) != 3 {
+		t.Fatalf("unexpected leftovers: %v", store.objects)
+	}
+}
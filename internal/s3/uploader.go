@@ -0,0 +1,317 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"image-api/internal/uploader"
+)
+
+var (
+	ErrBucketRequired = errors.New("bucket is required")
+	ErrRequestFailed  = errors.New("s3 request failed")
+)
+
+// md5MetadataHeader carries the hex MD5 of an object's content as user metadata.
+const md5MetadataHeader = "X-Amz-Meta-Md5"
+
+// Credentials are static access keys; SessionToken is only set for temporary credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Uploader stores objects in an S3-compatible bucket (AWS S3, MinIO, ...) using SigV4.
+type Uploader struct {
+	Client      *http.Client
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Credentials Credentials
+	// PathStyle addresses objects as endpoint/bucket/key instead of bucket.endpoint/key,
+	// which MinIO and most self-hosted stores need.
+	PathStyle bool
+	// PublicBaseURL, when set, replaces the endpoint in URLs returned by Upload (e.g. a CDN).
+	PublicBaseURL string
+
+	now func() time.Time
+}
+
+// NewUploader defaults the endpoint to AWS for region when endpoint is empty.
+func NewUploader(client *http.Client, endpoint, region, bucket string, creds Credentials, pathStyle bool) *Uploader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	return &Uploader{
+		Client:      client,
+		Endpoint:    strings.TrimRight(endpoint, "/"),
+		Region:      region,
+		Bucket:      bucket,
+		Credentials: creds,
+		PathStyle:   pathStyle,
+		now:         time.Now,
+	}
+}
+
+func (u *Uploader) Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error) {
+	// PUT the object, returning its (unsigned) URL.
+	resp, target, err := u.do(ctx, http.MethodPut, objectName, data, contentType)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", responseError(resp)
+	}
+
+	return u.publicURL(objectName, target), nil
+}
+
+func (u *Uploader) URL(ctx context.Context, objectName string) (string, error) {
+	target, err := u.objectURL(objectName)
+	if err != nil {
+		return "", err
+	}
+	return u.publicURL(objectName, target), nil
+}
+
+func (u *Uploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	resp, _, err := u.do(ctx, http.MethodGet, objectName, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Stat uses HEAD. The checksum is the MD5 Upload stores as object metadata: ETags are not
+// content hashes under SSE-KMS or for multipart uploads, so they are never used. Objects
+// written by other clients have no checksum.
+func (u *Uploader) Stat(ctx context.Context, objectName string) (uploader.ObjectInfo, error) {
+	resp, _, err := u.do(ctx, http.MethodHead, objectName, nil, "")
+	if err != nil {
+		return uploader.ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return uploader.ObjectInfo{}, fmt.Errorf("%w: %s", uploader.ErrNotFound, objectName)
+	}
+	if resp.StatusCode/100 != 2 {
+		return uploader.ObjectInfo{}, responseError(resp)
+	}
+
+	return uploader.ObjectInfo{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		Checksum:    resp.Header.Get(md5MetadataHeader),
+	}, nil
+}
+
+func (u *Uploader) Delete(ctx context.Context, objectName string) error {
+	resp, _, err := u.do(ctx, http.MethodDelete, objectName, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2 for every key under prefix.
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	target, err := u.bucketURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		target.RawQuery = canonicalQuery(query)
+
+		resp, err := u.send(ctx, http.MethodGet, target, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			err := responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode list response: %w", err)
+		}
+
+		for _, item := range page.Contents {
+			names = append(names, item.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// SignURL returns a presigned URL. S3 cannot bound the size of a presigned PUT,
+// so opts.MaxBytes is left to readers of the object to enforce.
+func (u *Uploader) SignURL(ctx context.Context, objectName string, opts uploader.SignOptions) (uploader.SignedURL, error) {
+	_ = ctx
+	if u.Credentials.AccessKeyID == "" || u.Credentials.SecretAccessKey == "" {
+		return uploader.SignedURL{}, uploader.ErrSigningNotConfigured
+	}
+	target, err := u.objectURL(objectName)
+	if err != nil {
+		return uploader.SignedURL{}, err
+	}
+
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		headers["Content-Type"] = opts.ContentType
+	}
+	return uploader.SignedURL{
+		URL:     u.presign(opts.Method, target, headers, opts.Expires),
+		Headers: headers,
+	}, nil
+}
+
+func (u *Uploader) do(ctx context.Context, method, objectName string, body []byte, contentType string) (*http.Response, *url.URL, error) {
+	// Send a signed request for one object.
+	if objectName == "" {
+		return nil, nil, errors.New("object name is required")
+	}
+	target, err := u.objectURL(objectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := u.send(ctx, method, target, body, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, target, nil
+}
+
+func (u *Uploader) send(ctx context.Context, method string, target *url.URL, body []byte, contentType string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if method == http.MethodPut {
+		// S3 rejects a body that does not match Content-MD5; the hex copy in metadata is what
+		// Stat reports back.
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		req.Header.Set(md5MetadataHeader, hex.EncodeToString(sum[:]))
+	}
+	u.sign(req, body)
+	return u.Client.Do(req)
+}
+
+func (u *Uploader) bucketURL() (*url.URL, error) {
+	// Path-style buckets live under the endpoint path, virtual-hosted ones in the host name.
+	if u.Bucket == "" {
+		return nil, ErrBucketRequired
+	}
+	endpoint, err := url.Parse(u.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", u.Endpoint)
+	}
+
+	target := *endpoint
+	if u.PathStyle {
+		target.Path = endpoint.Path + "/" + u.Bucket
+		target.RawPath = endpoint.Path + "/" + uriEncode(u.Bucket, true)
+	} else {
+		target.Host = u.Bucket + "." + endpoint.Host
+		target.Path = endpoint.Path
+		target.RawPath = endpoint.Path
+	}
+	return &target, nil
+}
+
+func (u *Uploader) objectURL(objectName string) (*url.URL, error) {
+	// Append the key to the bucket URL; the raw path keeps SigV4's encoding.
+	target, err := u.bucketURL()
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(objectName, "/")
+	target.Path += "/" + key
+	target.RawPath += "/" + uriEncode(key, false)
+	return target, nil
+}
+
+func (u *Uploader) publicURL(objectName string, target *url.URL) string {
+	if u.PublicBaseURL != "" {
+		return strings.TrimRight(u.PublicBaseURL, "/") + "/" + uriEncode(objectName, false)
+	}
+	return target.String()
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var parsed s3Error
+	if xml.Unmarshal(body, &parsed) == nil && parsed.Code != "" {
+		return fmt.Errorf("%w: status %d: %s: %s", ErrRequestFailed, resp.StatusCode, parsed.Code, parsed.Message)
+	}
+	return fmt.Errorf("%w: status %d", ErrRequestFailed, resp.StatusCode)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,60 @@
 package uploader
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
 
+var (
+	ErrNotFound             = errors.New("object not found")
+	ErrSigningNotConfigured = errors.New("url signing is not configured")
+)
+
+// Uploader stores objects and lists, reads, inspects and deletes them again. Open and Stat
+// return ErrNotFound for missing objects; deleting a missing object is not an error.
 type Uploader interface {
 	Upload(ctx context.Context, objectName string, data []byte, contentType string) (string, error)
+	// URL returns the URL Upload returns for objectName, without touching storage.
+	URL(ctx context.Context, objectName string) (string, error)
+	Open(ctx context.Context, objectName string) (io.ReadCloser, error)
+	Stat(ctx context.Context, objectName string) (ObjectInfo, error)
+	Delete(ctx context.Context, objectName string) error
+	// List returns the names of all objects whose name starts with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ObjectInfo describes a stored object. Checksum is the hex MD5 of the content,
+// empty when the backend does not report one (e.g. composite or multipart objects).
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	Checksum    string
+}
+
+// SignOptions describes a request a client will make directly against storage.
+// ContentType and MaxBytes apply to PUT only; MaxBytes 0 means no limit.
+type SignOptions struct {
+	Method      string
+	ContentType string
+	MaxBytes    int64
+	Expires     time.Duration
+}
+
+// SignedURL is a time-limited URL plus the headers the client must send with it unchanged.
+type SignedURL struct {
+	URL     string
+	Headers map[string]string
+}
+
+// PrivateUploader is implemented by uploaders whose Upload grants public read access per
+// object. UploadPrivate stores an object, such as a customer's source image, without it.
+type PrivateUploader interface {
+	UploadPrivate(ctx context.Context, objectName string, data []byte, contentType string) error
+}
+
+// URLSigner is implemented by uploaders that can hand out signed object URLs.
+type URLSigner interface {
+	SignURL(ctx context.Context, objectName string, opts SignOptions) (SignedURL, error)
 }
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestDeliverSignsBody(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"jobId":"abc","status":"done"}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if err != nil || !Verify(secret, timestamp, got, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(DeliveryHeader) != "delivery-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if err := Deliver(context.Background(), server.Client(), server.URL, "delivery-1", body, secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := Deliver(context.Background(), server.Client(), server.URL, "delivery-1", body, []byte("wrong"))
+	if !errors.Is(err, ErrDeliveryFailed) {
+		t.Fatalf("expected ErrDeliveryFailed, got %v", err)
+	}
+}
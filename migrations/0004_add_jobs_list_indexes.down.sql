@@ -0,0 +1 @@
+ALTER TABLE jobs DROP INDEX idx_jobs_status_created_at_id, DROP INDEX idx_jobs_created_at_id;
@@ -0,0 +1,3 @@
+ALTER TABLE jobs
+  ADD INDEX idx_jobs_created_at_id (created_at, id),
+  ADD INDEX idx_jobs_status_created_at_id (status, created_at, id);
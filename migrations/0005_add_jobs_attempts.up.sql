@@ -0,0 +1 @@
+ALTER TABLE jobs ADD COLUMN attempts INT NOT NULL DEFAULT 1;
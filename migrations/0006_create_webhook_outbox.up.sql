@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+  id CHAR(36) PRIMARY KEY,
+  job_id CHAR(36) NOT NULL,
+  url TEXT NOT NULL,
+  payload JSON NOT NULL,
+  delivered_at VARCHAR(32),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at VARCHAR(32) NOT NULL,
+  last_error TEXT,
+  created_at VARCHAR(32) NOT NULL,
+  updated_at VARCHAR(32) NOT NULL,
+  INDEX idx_webhook_outbox_due (delivered_at, next_attempt_at)
+);
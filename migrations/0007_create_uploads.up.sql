@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS uploads (
+  id CHAR(36) PRIMARY KEY,
+  object_name VARCHAR(512) NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  expires_at VARCHAR(32) NOT NULL,
+  created_at VARCHAR(32) NOT NULL
+);
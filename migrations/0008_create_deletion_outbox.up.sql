@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS deletion_outbox (
+  id CHAR(36) PRIMARY KEY,
+  job_id CHAR(36) NOT NULL,
+  prefix VARCHAR(512) NOT NULL,
+  completed_at VARCHAR(32),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at VARCHAR(32) NOT NULL,
+  last_error TEXT,
+  created_at VARCHAR(32) NOT NULL,
+  updated_at VARCHAR(32) NOT NULL,
+  INDEX idx_deletion_outbox_due (completed_at, next_attempt_at)
+);
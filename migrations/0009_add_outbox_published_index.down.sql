@@ -0,0 +1 @@
+ALTER TABLE outbox DROP INDEX idx_outbox_published_at;
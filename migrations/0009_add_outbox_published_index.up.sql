@@ -0,0 +1 @@
+ALTER TABLE outbox ADD INDEX idx_outbox_published_at (published_at);
@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys DROP INDEX idx_idempotency_keys_created_at;
@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys ADD INDEX idx_idempotency_keys_created_at (created_at);
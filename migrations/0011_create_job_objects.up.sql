@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS job_objects (
+  job_id CHAR(36) NOT NULL,
+  object_name VARCHAR(512) NOT NULL,
+  created_at VARCHAR(32) NOT NULL,
+  PRIMARY KEY (job_id, object_name),
+  INDEX idx_job_objects_object (object_name)
+);
@@ -0,0 +1 @@
+ALTER TABLE jobs DROP INDEX idx_jobs_status_claimed_at, DROP COLUMN claimed_at;
@@ -0,0 +1,2 @@
+ALTER TABLE jobs ADD COLUMN claimed_at VARCHAR(32) NULL, ADD INDEX idx_jobs_status_claimed_at (status, claimed_at);
+UPDATE jobs SET claimed_at = updated_at WHERE status = 'in_progress';
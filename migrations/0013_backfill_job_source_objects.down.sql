@@ -0,0 +1 @@
+DELETE FROM job_objects WHERE object_name LIKE 'sources/%';
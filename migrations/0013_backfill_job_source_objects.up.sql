@@ -0,0 +1,4 @@
+INSERT IGNORE INTO job_objects (job_id, object_name, created_at)
+SELECT jobs.id, sources.object_name, jobs.created_at
+FROM jobs, JSON_TABLE(jobs.payload, '$.images[*]' COLUMNS (object_name VARCHAR(512) PATH '$.sourceObject')) AS sources
+WHERE sources.object_name IS NOT NULL;
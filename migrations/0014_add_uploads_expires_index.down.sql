@@ -0,0 +1 @@
+ALTER TABLE uploads DROP INDEX idx_uploads_expires_at;
@@ -0,0 +1 @@
+ALTER TABLE uploads ADD INDEX idx_uploads_expires_at (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE uploads DROP COLUMN consumed_at;
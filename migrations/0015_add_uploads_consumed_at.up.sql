@@ -0,0 +1 @@
+ALTER TABLE uploads ADD COLUMN consumed_at VARCHAR(32) NULL;
@@ -0,0 +1 @@
+ALTER TABLE jobs ADD COLUMN claim_token CHAR(36) NULL;